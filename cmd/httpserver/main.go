@@ -2,25 +2,80 @@ package main
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/lordvorath/httpfromtcp/internal/accesslog"
+	"github.com/lordvorath/httpfromtcp/internal/client"
+	"github.com/lordvorath/httpfromtcp/internal/compression"
+	"github.com/lordvorath/httpfromtcp/internal/fileserver"
+	"github.com/lordvorath/httpfromtcp/internal/metrics"
+	"github.com/lordvorath/httpfromtcp/internal/negotiate"
+	"github.com/lordvorath/httpfromtcp/internal/proxy"
 	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/requestid"
 	"github.com/lordvorath/httpfromtcp/internal/response"
 	"github.com/lordvorath/httpfromtcp/internal/server"
+	"github.com/lordvorath/httpfromtcp/internal/tracing"
+	"github.com/lordvorath/httpfromtcp/internal/websocket"
 )
 
 const port = 42069
 
+var assets *fileserver.FileServer
+
+var httpbin *proxy.Proxy
+
 func main() {
-	server, err := server.Serve(port, myHandler)
+	var err error
+	assets, err = fileserver.New("./assets")
+	if err != nil {
+		log.Printf("Not serving /assets/: %v", err)
+	} else {
+		assets.Prefix = "/assets"
+		assets.ListDirectories = true
+	}
+
+	httpbin, err = proxy.New("https://httpbin.org")
+	if err != nil {
+		log.Fatalf("Error creating proxy: %v", err)
+	}
+	httpbin.StripPrefix = "/proxy"
+
+	// spans are only written out when TRACES_FILE is set
+	var exporter tracing.Exporter
+	if path := os.Getenv("TRACES_FILE"); path != "" {
+		fileExporter, err := tracing.NewJSONFileExporter(path)
+		if err != nil {
+			log.Fatalf("Error opening traces file: %v", err)
+		}
+		defer fileExporter.Close()
+		exporter = fileExporter
+	}
+	tracer := tracing.NewTracer(exporter)
+
+	handler := server.Chain(myHandler,
+		requestid.Middleware(requestid.Options{}),
+		accesslog.Middleware(accesslog.New(os.Stdout, accesslog.Combined)),
+		tracer.Middleware,
+		compression.DecodeRequest(compression.DecodeOptions{}),
+		compression.Middleware(compression.Options{}),
+	)
+	server, err := server.ServeConfig(server.Config{
+		Port:    port,
+		Handler: handler,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+		Metrics: metrics.NewRegistry(),
+	})
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -38,10 +93,22 @@ func myHandler(w *response.Writer, req *request.Request) {
 		handleChunked(w, req)
 		return
 	}
+	if strings.HasPrefix(req.RequestLine.RequestTarget, "/proxy/") {
+		httpbin.Handle(w, req)
+		return
+	}
 	if strings.HasPrefix(req.RequestLine.RequestTarget, "/video") {
 		handleVideo(w, req)
 		return
 	}
+	if strings.HasPrefix(req.RequestLine.RequestTarget, "/assets/") && assets != nil {
+		assets.Handle(w, req)
+		return
+	}
+	if req.RequestLine.RequestTarget == "/ws" {
+		handleWebSocket(w, req)
+		return
+	}
 
 	var code response.StatusCode = response.StatusOk
 	var message string = "OK"
@@ -61,19 +128,37 @@ func myHandler(w *response.Writer, req *request.Request) {
 		body = "Okay, you know what? This one is on me.."
 	}
 
-	html := `<html><head><title>$CODE $MESSAGE</title></head><body><h1>$TITLE</h1><p>$BODY</p></body></html>`
-	html = strings.Replace(html, "$CODE", strconv.Itoa(int(code)), -1)
-	html = strings.Replace(html, "$MESSAGE", message, -1)
-	html = strings.Replace(html, "$TITLE", title, -1)
-	html = strings.Replace(html, "$BODY", body, -1)
+	contentType, ok := negotiate.ContentType(w, req, "text/html", "application/json", "text/plain")
+	if !ok {
+		return
+	}
 
-	w.WriteStatusLine(code)
+	var out []byte
+	switch contentType {
+	case "text/html":
+		html := `<html><head><title>$CODE $MESSAGE</title></head><body><h1>$TITLE</h1><p>$BODY</p></body></html>`
+		html = strings.Replace(html, "$CODE", strconv.Itoa(int(code)), -1)
+		html = strings.Replace(html, "$MESSAGE", message, -1)
+		html = strings.Replace(html, "$TITLE", title, -1)
+		html = strings.Replace(html, "$BODY", body, -1)
+		out = []byte(html)
+	case "application/json":
+		out, _ = json.Marshal(map[string]any{"status": code, "message": message, "title": title, "body": body})
+	case "text/plain":
+		out = []byte(fmt.Sprintf("%d %s\n%s\n%s\n", code, message, title, body))
+	}
 
-	headers := response.GetDefaultHeaders(len(html))
-	headers.Set("Content-Type", "text/html")
+	headers := response.GetDefaultHeaders(len(out))
+	headers.Set("Content-Type", contentType)
+	response.SetValidators(headers, response.StrongETag(out), time.Time{})
+	if code == response.StatusOk && w.WritePreconditions(req, headers) {
+		return
+	}
+
+	w.WriteStatusLine(code)
 	w.WriteHeaders(headers)
 
-	_, err := w.WriteBody([]byte(html))
+	_, err := w.WriteBody(out)
 	if err != nil {
 		return
 	}
@@ -88,12 +173,35 @@ func handleChunked(w *response.Writer, req *request.Request) {
 	// From the solution because httpbin.org is down
 	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
 	url := "https://httpbin.org/" + target
-	fmt.Println("Proxying to", url)
-	resp, err := http.Get(url)
+	w.Logger().Debug("proxying", "url", url)
+
+	// stop talking to upstream once our own client has gone away
+	upstreamReq, err := client.NewRequestWithContext(req.Context(), "GET", url, nil)
 	if err != nil {
 		handler500(w, req)
 		return
 	}
+
+	// there is only a span when the tracing middleware is in the chain
+	span := tracing.SpanFromRequest(req)
+	if span != nil {
+		span = span.StartChild("GET", tracing.KindClient)
+		span.SetAttribute("http.request.method", "GET")
+		span.SetAttribute("url.full", url)
+		span.Inject(upstreamReq.Headers)
+		defer span.Finish()
+	}
+	resp, err := client.DefaultClient.Do(upstreamReq)
+	if err != nil {
+		if span != nil {
+			span.SetError(err.Error())
+		}
+		handler500(w, req)
+		return
+	}
+	if span != nil {
+		span.SetAttribute("http.response.status_code", int(resp.StatusCode))
+	}
 	defer resp.Body.Close()
 
 	data := make([]byte, chunkSize)
@@ -111,11 +219,10 @@ func handleChunked(w *response.Writer, req *request.Request) {
 	fullBody := make([]byte, 0)
 	for {
 		n, err := resp.Body.Read(data)
-		fmt.Println("Read", n, "bytes")
 		if n > 0 {
 			_, err := w.WriteChunkedBody(data[:n])
 			if err != nil {
-				fmt.Println("Error writing chunked body:", err)
+				w.Logger().Warn("failed to write chunked body", "error", err)
 				break
 			}
 			fullBody = append(fullBody, data[:n]...)
@@ -124,14 +231,14 @@ func handleChunked(w *response.Writer, req *request.Request) {
 			break
 		}
 		if err != nil {
-			fmt.Println("Error reading response body:", err)
+			w.Logger().Warn("failed to read upstream body", "url", url, "error", err)
 			break
 		}
 
 	}
 	_, err = w.WriteChunkedBodyDone()
 	if err != nil {
-		fmt.Printf("failed to write end of chunked body: %v", err)
+		w.Logger().Warn("failed to write end of chunked body", "error", err)
 		return
 	}
 
@@ -142,7 +249,7 @@ func handleChunked(w *response.Writer, req *request.Request) {
 
 	err = w.WriteTrailers(headers)
 	if err != nil {
-		fmt.Printf("error writing trailers: %v", err)
+		w.Logger().Warn("failed to write trailers", "error", err)
 	}
 
 }
@@ -165,20 +272,30 @@ func handler500(w *response.Writer, _ *request.Request) {
 	w.WriteBody(body)
 }
 
-func handleVideo(w *response.Writer, _ *request.Request) {
-	data, err := os.ReadFile("./assets/vim.mp4")
+func handleVideo(w *response.Writer, req *request.Request) {
+	fileserver.ServeFile(w, req, "./assets/vim.mp4")
+}
+
+var upgrader = websocket.Upgrader{
+	EnableCompression: true,
+}
+
+func handleWebSocket(w *response.Writer, req *request.Request) {
+	conn, err := upgrader.Upgrade(w, req)
 	if err != nil {
-		fmt.Printf("error reading file: %v", err)
+		w.Logger().Info("websocket upgrade failed", "error", err)
 		return
 	}
+	defer conn.Close()
 
-	var code response.StatusCode = response.StatusOk
-	headers := response.GetDefaultHeaders(len(data))
-	headers.Set("Content-Type", "video/mp4")
-
-	w.WriteStatusLine(code)
-	w.WriteHeaders(headers)
-
-	w.WriteBody(data)
-
+	for {
+		mt, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		err = conn.WriteMessage(mt, msg)
+		if err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/websocket"
+)
+
+func main() {
+	d := websocket.Dialer{
+		EnableCompression: true,
+	}
+	conn, err := d.Dial("localhost:42069", "/ws")
+	if err != nil {
+		log.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.CloseWithCode(websocket.CloseNormalClosure, "")
+
+	buff := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Print("> ")
+		inp, err := buff.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		err = conn.WriteMessage(websocket.TextMessage, []byte(strings.TrimRight(inp, "\n")))
+		if err != nil {
+			log.Fatalf("failed to send message: %v", err)
+		}
+
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			log.Fatalf("failed to read message: %v", err)
+		}
+		fmt.Println(string(msg))
+	}
+}
@@ -0,0 +1,176 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+type Format int
+
+const (
+	// Common is the Apache Common Log Format.
+	Common Format = iota
+	// Combined is Common plus the Referer and User-Agent.
+	Combined
+	// JSON writes one JSON object per line.
+	JSON
+)
+
+// Attribute keys of the access log records.
+const (
+	KeyRemoteAddr = "remote_addr"
+	KeyMethod     = "method"
+	KeyTarget     = "target"
+	KeyProto      = "proto"
+	KeyStatus     = "status"
+	KeyBytes      = "bytes"
+	KeyDuration   = "duration_ms"
+	KeyUserAgent  = "user_agent"
+	KeyReferer    = "referer"
+	KeyRequestID  = "request_id"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// New returns a logger writing access log records to out in the given format.
+func New(out io.Writer, format Format) *slog.Logger {
+	if format == JSON {
+		return slog.New(slog.NewJSONHandler(out, nil))
+	}
+	return slog.New(&clfHandler{out: out, combined: format == Combined, mu: &sync.Mutex{}})
+}
+
+// Middleware logs one record per request to logger once the handler returns.
+func Middleware(logger *slog.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			duration := time.Since(start)
+
+			userAgent, _ := req.Headers.Get("User-Agent")
+			referer, _ := req.Headers.Get("Referer")
+			record := slog.NewRecord(start, slog.LevelInfo, "request", 0)
+			record.AddAttrs(
+				slog.String(KeyRemoteAddr, req.RemoteAddr),
+				slog.String(KeyMethod, req.RequestLine.Method),
+				slog.String(KeyTarget, req.RequestLine.RequestTarget),
+				slog.String(KeyProto, "HTTP/"+req.RequestLine.HttpVersion),
+				slog.Int(KeyStatus, int(w.StatusCode())),
+				slog.Int64(KeyBytes, w.BytesWritten()),
+				slog.Float64(KeyDuration, float64(duration.Microseconds())/1000),
+				slog.String(KeyUserAgent, userAgent),
+				slog.String(KeyReferer, referer),
+			)
+			if id := req.RequestID(); id != "" {
+				record.AddAttrs(slog.String(KeyRequestID, id))
+			}
+			logger.Handler().Handle(context.Background(), record)
+		}
+	}
+}
+
+// clfHandler formats access log records as Apache Common or Combined log lines.
+type clfHandler struct {
+	out      io.Writer
+	combined bool
+	attrs    []slog.Attr
+	mu       *sync.Mutex
+}
+
+func (h *clfHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *clfHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *clfHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *clfHandler) Handle(_ context.Context, r slog.Record) error {
+	values := map[string]slog.Value{}
+	for _, a := range h.attrs {
+		values[a.Key] = a.Value
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		values[a.Key] = a.Value
+		return true
+	})
+	get := func(key string) string {
+		v, ok := values[key]
+		if !ok {
+			return ""
+		}
+		return v.String()
+	}
+
+	host := get(KeyRemoteAddr)
+	if ip, _, err := net.SplitHostPort(host); err == nil {
+		host = ip
+	}
+	bytes := get(KeyBytes)
+	if bytes == "" || bytes == "0" {
+		bytes = "-"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(orDash(host))
+	sb.WriteString(" - - [")
+	sb.WriteString(r.Time.Format(clfTimeFormat))
+	sb.WriteString("] \"")
+	sb.WriteString(escape(get(KeyMethod) + " " + get(KeyTarget) + " " + get(KeyProto)))
+	sb.WriteString("\" ")
+	sb.WriteString(orDash(get(KeyStatus)))
+	sb.WriteString(" ")
+	sb.WriteString(bytes)
+	if h.combined {
+		sb.WriteString(" \"" + escape(orDash(get(KeyReferer))) + "\"")
+		sb.WriteString(" \"" + escape(orDash(get(KeyUserAgent))) + "\"")
+	}
+	sb.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, sb.String())
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape keeps quotes and control characters from breaking up the log line.
+func escape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, format Format) string {
+	req, err := request.RequestFromReader(strings.NewReader("GET /index.html?x=1 HTTP/1.1\r\n" +
+		"User-Agent: curl/8.0 \"quoted\"\r\nReferer: http://example.com/\r\n\r\n"))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+
+	var out bytes.Buffer
+	handler := Middleware(New(&out, format))(func(w *response.Writer, _ *request.Request) {
+		w.WriteResponse(response.StatusNotFound, nil, []byte("not here"))
+	})
+	handler(&response.Writer{W: &bytes.Buffer{}}, req)
+	return out.String()
+}
+
+func TestFormats(t *testing.T) {
+	// Test: Common
+	line := serve(t, Common)
+	assert.Regexp(t, regexp.MustCompile(`^192\.0\.2\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] `+
+		`"GET /index\.html\?x=1 HTTP/1\.1" 404 8\n$`), line)
+
+	// Test: Combined escapes quotes
+	line = serve(t, Combined)
+	assert.True(t, strings.HasSuffix(line, `" 404 8 "http://example.com/" "curl/8.0 \"quoted\""`+"\n"), line)
+
+	// Test: JSON lines
+	line = serve(t, JSON)
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal([]byte(line), &rec))
+	assert.Equal(t, "192.0.2.7:51234", rec[KeyRemoteAddr])
+	assert.Equal(t, "GET", rec[KeyMethod])
+	assert.Equal(t, "/index.html?x=1", rec[KeyTarget])
+	assert.Equal(t, "HTTP/1.1", rec[KeyProto])
+	assert.Equal(t, 404.0, rec[KeyStatus])
+	assert.Equal(t, 8.0, rec[KeyBytes])
+	assert.Contains(t, rec, KeyDuration)
+	assert.Equal(t, `curl/8.0 "quoted"`, rec[KeyUserAgent])
+	assert.Equal(t, "http://example.com/", rec[KeyReferer])
+	assert.NotContains(t, rec, KeyRequestID)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	// Test: Files rotate past MaxSize and only MaxBackups are kept
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err := rf.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	require.NoError(t, rf.Close())
+
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "dddddd\n", read(path))
+	assert.Equal(t, "cccccc\n", read(path+".1"))
+	assert.Equal(t, "bbbbbb\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3")
+
+	// Test: Reopening appends to the current file
+	rf, err = NewRotatingFile(path, 100, 2)
+	require.NoError(t, err)
+	rf.Write([]byte("eeeeee\n"))
+	rf.Close()
+	assert.Equal(t, "dddddd\neeeeee\n", read(path))
+}
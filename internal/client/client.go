@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const (
+	defaultMaxRedirects = 10
+	defaultDialTimeout  = 30 * time.Second
+)
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers headers.Headers
+	Body    []byte
+
+	ctx context.Context
+}
+
+func NewRequest(method, rawURL string, body []byte) (*Request, error) {
+	return NewRequestWithContext(context.Background(), method, rawURL, body)
+}
+
+// NewRequestWithContext makes a request that is abandoned as soon as ctx is done.
+func NewRequestWithContext(ctx context.Context, method, rawURL string, body []byte) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in url: %q", rawURL)
+	}
+	return &Request{
+		Method:  method,
+		URL:     u,
+		Headers: headers.NewHeaders(),
+		Body:    body,
+		ctx:     ctx,
+	}, nil
+}
+
+// Context returns the request's context, or context.Background() if it has none.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+type Response struct {
+	StatusCode response.StatusCode
+	// Reason is the reason phrase from the status line.
+	Reason  string
+	Proto   string
+	Headers headers.Headers
+	// SetCookies holds each Set-Cookie value separately, since they can't be comma-joined into Headers.
+	SetCookies []string
+	// ContentLength is -1 when the length isn't known up front.
+	ContentLength int64
+	// Body streams the response body. It must be closed.
+	Body io.ReadCloser
+	// Trailers is filled in once Body has been read to the end.
+	Trailers headers.Headers
+	// Request is the request that produced this response, the last one if redirects were followed.
+	Request *Request
+}
+
+type Client struct {
+	// Timeout bounds the whole exchange, redirects and reading the body included. Zero means no limit.
+	Timeout time.Duration
+	// MaxRedirects is how many redirects are followed. Zero means 10, negative means none.
+	MaxRedirects int
+	// Transport provides the connections. Defaults to DefaultTransport.
+	Transport *Transport
+}
+
+var DefaultClient = &Client{}
+
+func (c *Client) Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req and returns the response once its headers have arrived, following redirects unless
+// MaxRedirects is negative. The caller must read the body to the end for the connection to be reused,
+// and must close it.
+func (c *Client) Do(req *Request) (*Response, error) {
+	t := c.Transport
+	if t == nil {
+		t = DefaultTransport
+	}
+
+	var deadline time.Time
+	if c.Timeout > 0 {
+		deadline = time.Now().Add(c.Timeout)
+	}
+
+	maxRedirects := c.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	for redirects := 0; ; redirects++ {
+		resp, err := t.roundTrip(req, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if maxRedirects < 0 {
+			return resp, nil
+		}
+		next, err := redirectRequest(req, resp)
+		if err != nil || next == nil {
+			if err != nil {
+				resp.Body.Close()
+			}
+			return resp, err
+		}
+		resp.Body.Close()
+		if redirects >= maxRedirects {
+			return nil, fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+		}
+		req = next
+	}
+}
+
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// redirectRequest returns the request to follow resp with, or nil if resp isn't a redirect.
+// 301, 302 and 303 turn into a GET without a body, 307 and 308 repeat the request as it was.
+func redirectRequest(req *Request, resp *Response) (*Request, error) {
+	method := req.Method
+	body := req.Body
+	switch resp.StatusCode {
+	case 301, 302, 303:
+		if method != "HEAD" {
+			method = "GET"
+		}
+		body = nil
+	case 307, 308:
+	default:
+		return nil, nil
+	}
+
+	loc, ok := resp.Headers.Get("Location")
+	if !ok || loc == "" {
+		return nil, nil
+	}
+	u, err := req.URL.Parse(loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %v", loc, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported redirect location %q", loc)
+	}
+
+	h := headers.NewHeaders()
+	for k, v := range req.Headers {
+		h[k] = v
+	}
+	h.Del("Host")
+	if body == nil {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+	}
+	// credentials stay with the host they were meant for
+	if !strings.EqualFold(u.Host, req.URL.Host) {
+		h.Del("Authorization")
+		h.Del("Cookie")
+	}
+
+	return &Request{
+		Method:  method,
+		URL:     u,
+		Headers: h,
+		Body:    body,
+		ctx:     req.ctx,
+	}, nil
+}
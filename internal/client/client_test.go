@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawServer answers every connection with reply once the request headers have arrived.
+func rawServer(t *testing.T, reply string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				conn.Read(buf)
+				conn.Write([]byte(reply))
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String()
+}
+
+func readAll(t *testing.T, resp *Response) string {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Target", r.URL.RequestURI())
+		w.Header().Set("X-Custom", r.Header.Get("X-Custom"))
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	// Test: Request line, headers and body reach the server, Content-Length framed response
+	req, err := NewRequest("POST", srv.URL+"/items?x=1", []byte("hello"))
+	require.NoError(t, err)
+	req.Headers.Set("X-Custom", "yes")
+	resp, err := DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(201), resp.StatusCode)
+	assert.Equal(t, "Created", resp.Reason)
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+	assert.Equal(t, int64(5), resp.ContentLength)
+	assert.Equal(t, "POST", resp.Headers["x-method"])
+	assert.Equal(t, "/items?x=1", resp.Headers["x-target"])
+	assert.Equal(t, "yes", resp.Headers["x-custom"])
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.SetCookies)
+	assert.Equal(t, "hello", readAll(t, resp))
+
+	// Test: Reading after Close fails
+	_, err = resp.Body.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrBodyClosed)
+}
+
+func TestBodyFraming(t *testing.T) {
+	// Test: Chunked body with trailers
+	url := rawServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n"+
+		"5;ext=1\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: abc\r\n\r\n")
+	resp, err := DefaultClient.Get(url)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Empty(t, resp.Trailers)
+	assert.Equal(t, "hello, world", readAll(t, resp))
+	assert.Equal(t, "abc", resp.Trailers["x-sum"])
+
+	// Test: Body delimited by the connection closing
+	url = rawServer(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil close")
+	resp, err = DefaultClient.Get(url)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", resp.Proto)
+	assert.Equal(t, "until close", readAll(t, resp))
+
+	// Test: Interim responses are skipped, empty reason phrase is fine
+	url = rawServer(t, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 299 \r\nContent-Length: 2\r\n\r\nok")
+	resp, err = DefaultClient.Get(url)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(299), resp.StatusCode)
+	assert.Equal(t, "", resp.Reason)
+	assert.Equal(t, "ok", readAll(t, resp))
+
+	// Test: Truncated bodies
+	url = rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort")
+	resp, err = DefaultClient.Get(url)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	resp.Body.Close()
+
+	url = rawServer(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	resp, err = DefaultClient.Get(url)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+	resp.Body.Close()
+
+	// Test: HEAD has no body whatever Content-Length says
+	url = rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n")
+	req, err := NewRequest("HEAD", url, nil)
+	require.NoError(t, err)
+	resp, err = DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), resp.ContentLength)
+	assert.Equal(t, "", readAll(t, resp))
+}
+
+func TestMalformedResponses(t *testing.T) {
+	for _, reply := range []string{
+		"HTTP/2 200 OK\r\n\r\n",
+		"HTTP/1.1 20 OK\r\n\r\n",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nBad Header\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 1, 2\r\n\r\n",
+		"HTTP/1.1 200 OK\r\n",
+	} {
+		_, err := DefaultClient.Get(rawServer(t, reply))
+		assert.Error(t, err, reply)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/see-other":
+			http.Redirect(w, r, "/final", http.StatusSeeOther)
+		case "/temporary":
+			http.Redirect(w, r, "final", http.StatusTemporaryRedirect)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Write([]byte(r.Method + " " + string(body)))
+		}
+	}))
+	defer srv.Close()
+
+	// Test: 303 turns into a GET without a body
+	req, err := NewRequest("POST", srv.URL+"/see-other", []byte("data"))
+	require.NoError(t, err)
+	resp, err := DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "GET ", readAll(t, resp))
+	assert.Equal(t, "/final", resp.Request.URL.Path)
+
+	// Test: 307 repeats the method and body, relative locations resolve against the request
+	req, err = NewRequest("POST", srv.URL+"/temporary", []byte("data"))
+	require.NoError(t, err)
+	resp, err = DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "POST data", readAll(t, resp))
+
+	// Test: Redirect loops give up
+	_, err = DefaultClient.Get(srv.URL + "/loop")
+	assert.ErrorIs(t, err, ErrTooManyRedirects)
+
+	// Test: Not following redirects
+	c := &Client{MaxRedirects: -1}
+	resp, err = c.Get(srv.URL + "/see-other")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, response.StatusCode(303), resp.StatusCode)
+	assert.Equal(t, "/final", resp.Headers["location"])
+}
+
+func TestTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// Test: Client timeout
+	c := &Client{Timeout: 50 * time.Millisecond}
+	_, err := c.Get(srv.URL)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr), "%v", err)
+	assert.True(t, netErr.Timeout())
+
+	// Test: Context cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	require.NoError(t, err)
+	_, err = DefaultClient.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+
+	c := &Client{Transport: &Transport{TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}}
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "secure", readAll(t, resp))
+}
+
+func TestNewRequest(t *testing.T) {
+	_, err := NewRequest("GET", "ftp://example.com/", nil)
+	assert.Error(t, err)
+	_, err = NewRequest("GET", "/relative", nil)
+	assert.Error(t, err)
+}
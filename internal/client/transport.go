@@ -0,0 +1,403 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxIdleConnsPerHost = 2
+	defaultIdleTimeout         = 90 * time.Second
+	maxRetries                 = 3
+)
+
+// Transport dials connections and keeps them open between requests, reusing them per scheme and host.
+type Transport struct {
+	// DialTimeout bounds connecting to a server. Defaults to 30s.
+	DialTimeout time.Duration
+	// TLSConfig is used for https URLs.
+	TLSConfig *tls.Config
+	// MaxIdleConnsPerHost caps how many unused connections are kept per host. Defaults to 2.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps open connections per host, in use or idle. Requests wait for a free one.
+	// Zero means no limit.
+	MaxConnsPerHost int
+	// IdleTimeout is how long an unused connection is kept. Defaults to 90s.
+	IdleTimeout time.Duration
+	// DisableKeepAlives uses every connection for a single request.
+	DisableKeepAlives bool
+
+	mu      sync.Mutex
+	idle    map[string][]*persistConn
+	conns   map[string]int
+	waiters map[string][]chan struct{}
+}
+
+var DefaultTransport = &Transport{}
+
+// CloseIdleConnections closes every connection that isn't carrying a request.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+	for _, conns := range idle {
+		for _, pc := range conns {
+			pc.close()
+		}
+	}
+}
+
+// roundTrip sends req and reads the response headers. A request that fails on a reused connection
+// before any of the response arrived is retried on another connection when it is idempotent,
+// since the server most likely closed the connection while it sat in the pool.
+func (t *Transport) roundTrip(req *Request, deadline time.Time) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		pc, err := t.getConn(req.Context(), req.URL, deadline)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := pc.roundTrip(req, deadline)
+		if err == nil {
+			return resp, nil
+		}
+		pc.close()
+		if !pc.reused || pc.nread > 0 || !isIdempotent(req.Method) || req.Context().Err() != nil ||
+			attempt >= maxRetries {
+			return nil, err
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func connKey(u *url.URL) string {
+	return u.Scheme + "://" + hostPort(u)
+}
+
+// getConn returns a healthy idle connection for u, or dials a new one once MaxConnsPerHost allows it.
+func (t *Transport) getConn(ctx context.Context, u *url.URL, deadline time.Time) (*persistConn, error) {
+	key := connKey(u)
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	for {
+		t.mu.Lock()
+		pc := t.popIdle(key)
+		if pc != nil {
+			t.mu.Unlock()
+			if pc.takeFromPool(t.idleTimeout()) {
+				return pc, nil
+			}
+			pc.close()
+			continue
+		}
+		if t.MaxConnsPerHost <= 0 || t.conns[key] < t.MaxConnsPerHost {
+			if t.conns == nil {
+				t.conns = map[string]int{}
+			}
+			t.conns[key]++
+			t.mu.Unlock()
+			pc, err := t.dial(ctx, u, key)
+			if err != nil {
+				t.connClosed(key)
+				return nil, err
+			}
+			return pc, nil
+		}
+		ready := make(chan struct{})
+		if t.waiters == nil {
+			t.waiters = map[string][]chan struct{}{}
+		}
+		t.waiters[key] = append(t.waiters[key], ready)
+		t.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.removeWaiter(key, ready)
+			t.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// popIdle returns the most recently used idle connection for key. t.mu must be held.
+func (t *Transport) popIdle(key string) *persistConn {
+	conns := t.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	pc := conns[len(conns)-1]
+	t.idle[key] = conns[:len(conns)-1]
+	if len(t.idle[key]) == 0 {
+		delete(t.idle, key)
+	}
+	return pc
+}
+
+// removeIdle takes pc out of the pool and reports whether it was still there. t.mu must be held.
+func (t *Transport) removeIdle(pc *persistConn) bool {
+	conns := t.idle[pc.key]
+	for i, c := range conns {
+		if c == pc {
+			t.idle[pc.key] = append(conns[:i], conns[i+1:]...)
+			if len(t.idle[pc.key]) == 0 {
+				delete(t.idle, pc.key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// removeWaiter drops a waiter that gave up. If it was signalled in the meantime the signal goes to the next one.
+func (t *Transport) removeWaiter(key string, ready chan struct{}) {
+	waiters := t.waiters[key]
+	for i, w := range waiters {
+		if w == ready {
+			t.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			return
+		}
+	}
+	t.wakeWaiter(key)
+}
+
+// wakeWaiter lets one request waiting for a connection to key try again. t.mu must be held.
+func (t *Transport) wakeWaiter(key string) {
+	waiters := t.waiters[key]
+	if len(waiters) == 0 {
+		return
+	}
+	close(waiters[0])
+	t.waiters[key] = waiters[1:]
+	if len(t.waiters[key]) == 0 {
+		delete(t.waiters, key)
+	}
+}
+
+// putIdle returns pc to the pool, or closes it if the pool for its host is full.
+func (t *Transport) putIdle(pc *persistConn) {
+	t.mu.Lock()
+	if t.DisableKeepAlives || len(t.idle[pc.key]) >= t.maxIdleConnsPerHost() {
+		t.mu.Unlock()
+		pc.close()
+		return
+	}
+	if t.idle == nil {
+		t.idle = map[string][]*persistConn{}
+	}
+	pc.watchIdle(t.idleTimeout())
+	t.idle[pc.key] = append(t.idle[pc.key], pc)
+	t.wakeWaiter(pc.key)
+	t.mu.Unlock()
+}
+
+// connClosed forgets a connection to key and lets a waiting request dial a new one.
+func (t *Transport) connClosed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[key]--
+	if t.conns[key] <= 0 {
+		delete(t.conns, key)
+	}
+	t.wakeWaiter(key)
+}
+
+func (t *Transport) maxIdleConnsPerHost() int {
+	if t.MaxIdleConnsPerHost == 0 {
+		return defaultMaxIdleConnsPerHost
+	}
+	return t.MaxIdleConnsPerHost
+}
+
+func (t *Transport) idleTimeout() time.Duration {
+	if t.IdleTimeout == 0 {
+		return defaultIdleTimeout
+	}
+	return t.IdleTimeout
+}
+
+func (t *Transport) dial(ctx context.Context, u *url.URL, key string) (*persistConn, error) {
+	timeout := t.DialTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+
+	addr := hostPort(u)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if u.Scheme == "https" {
+		cfg := &tls.Config{}
+		if t.TLSConfig != nil {
+			cfg = t.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("tls handshake with %s failed: %v", addr, err)
+		}
+		conn = tlsConn
+	}
+
+	pc := &persistConn{t: t, key: key, conn: conn}
+	pc.br = bufio.NewReaderSize(pc, readBufferSize)
+	return pc, nil
+}
+
+// persistConn is a connection that may carry several requests, one after the other.
+type persistConn struct {
+	t    *Transport
+	key  string
+	conn net.Conn
+	br   *bufio.Reader
+
+	// set per request
+	ctx    context.Context
+	stop   func() bool
+	reused bool
+	nread  int64
+
+	// set while idle
+	idleSince time.Time
+	watchDone chan error
+
+	closeOnce sync.Once
+}
+
+func (pc *persistConn) roundTrip(req *Request, deadline time.Time) (*Response, error) {
+	pc.ctx = req.Context()
+	pc.nread = 0
+	pc.conn.SetDeadline(deadline)
+	// unblock any read or write in progress once the context is done
+	pc.stop = context.AfterFunc(pc.ctx, func() {
+		pc.conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	keepAlive := !pc.t.DisableKeepAlives
+	err := writeRequest(pc.conn, req, keepAlive)
+	if err != nil {
+		pc.stop()
+		return nil, pc.wrap(err)
+	}
+	resp, err := readResponse(pc, req, keepAlive)
+	if err != nil {
+		pc.stop()
+		return nil, pc.wrap(err)
+	}
+	return resp, nil
+}
+
+// release ends the current request, handing the connection back to the pool if reuse is true.
+func (pc *persistConn) release(reuse bool) {
+	if !pc.stop() {
+		// the context fired and may have poisoned the deadline
+		reuse = false
+	}
+	pc.ctx = nil
+	if !reuse {
+		pc.close()
+		return
+	}
+	pc.conn.SetDeadline(time.Time{})
+	pc.reused = true
+	pc.t.putIdle(pc)
+}
+
+// watchIdle reads from an idle connection in the background so that a server closing it,
+// or the idle timeout running out, drops it from the pool.
+func (pc *persistConn) watchIdle(timeout time.Duration) {
+	pc.idleSince = time.Now()
+	pc.watchDone = make(chan error, 1)
+	pc.conn.SetReadDeadline(pc.idleSince.Add(timeout))
+	go func() {
+		// nothing may arrive on an idle connection, so data counts as a failure as much as EOF does
+		_, err := pc.br.Peek(1)
+		if err == nil {
+			err = errUnexpectedData
+		}
+
+		// Drop the connection before signalling: once takeFromPool has its answer the connection
+		// may be back in the pool with a new watcher, and must not be removed by this one.
+		// If takeFromPool ended the read, the connection is no longer in the pool and is left alone.
+		pc.t.mu.Lock()
+		inPool := pc.t.removeIdle(pc)
+		pc.t.mu.Unlock()
+		if inPool {
+			pc.close()
+		}
+		pc.watchDone <- err
+	}()
+}
+
+var errUnexpectedData = errors.New("unexpected data on idle connection")
+
+// takeFromPool stops the idle watcher and reports whether the connection is still fit for a request.
+func (pc *persistConn) takeFromPool(idleTimeout time.Duration) bool {
+	pc.conn.SetReadDeadline(time.Now())
+	err := <-pc.watchDone
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return false
+	}
+	if time.Since(pc.idleSince) >= idleTimeout {
+		return false
+	}
+	pc.conn.SetReadDeadline(time.Time{})
+	return true
+}
+
+func (pc *persistConn) Read(p []byte) (int, error) {
+	n, err := pc.conn.Read(p)
+	pc.nread += int64(n)
+	if err != nil && err != io.EOF && pc.ctx != nil {
+		err = pc.wrap(err)
+	}
+	return n, err
+}
+
+func (pc *persistConn) close() {
+	pc.closeOnce.Do(func() {
+		pc.conn.Close()
+		pc.t.connClosed(pc.key)
+	})
+}
+
+// wrap reports a cancelled context rather than the deadline used to interrupt the connection.
+func (pc *persistConn) wrap(err error) error {
+	if ctxErr := pc.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer is an httptest server that counts the connections made to it.
+func countingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+// oneShotServer answers the first request on each connection with a keep-alive response, then closes
+// the connection as soon as the next request arrives, like a server that timed it out at that moment.
+func oneShotServer(t *testing.T) (string, *atomic.Int32) {
+	var conns atomic.Int32
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				_, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				http.ReadRequest(br)
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String(), &conns
+}
+
+func get(t *testing.T, c *Client, url string) string {
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	return readAll(t, resp)
+}
+
+func TestConnectionReuse(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi"))
+	})
+	c := &Client{Transport: &Transport{}}
+
+	// Test: Sequential requests share a connection once bodies are read
+	for range 3 {
+		assert.Equal(t, "hi", get(t, c, srv.URL))
+	}
+	assert.Equal(t, int32(1), conns.Load())
+
+	// Test: A connection taken from the pool and put back right away stays open
+	for range 200 {
+		get(t, c, srv.URL)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+
+	// Test: Chunked and bodiless responses give the connection back too
+	srv2, conns2 := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+	})
+	assert.Equal(t, "chunk", get(t, c, srv2.URL))
+	resp, err := c.Get(srv2.URL + "/empty")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "chunk", get(t, c, srv2.URL))
+	assert.Equal(t, int32(1), conns2.Load())
+
+	// Test: Closing a body early gives up its connection
+	resp, err = c.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "hi", get(t, c, srv.URL))
+	assert.Equal(t, int32(2), conns.Load())
+
+	// Test: DisableKeepAlives
+	srv3, conns3 := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Connection")))
+	})
+	c = &Client{Transport: &Transport{DisableKeepAlives: true}}
+	assert.Equal(t, "close", get(t, c, srv3.URL))
+	assert.Equal(t, "close", get(t, c, srv3.URL))
+	assert.Equal(t, int32(2), conns3.Load())
+}
+
+func TestIdleLimits(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi"))
+	})
+
+	// Test: Idle connections expire
+	c := &Client{Transport: &Transport{IdleTimeout: 20 * time.Millisecond}}
+	assert.Equal(t, "hi", get(t, c, srv.URL))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, "hi", get(t, c, srv.URL))
+	assert.Equal(t, int32(2), conns.Load())
+
+	// Test: Only MaxIdleConnsPerHost connections are kept
+	conns.Store(0)
+	tr := &Transport{MaxIdleConnsPerHost: 1}
+	c = &Client{Transport: tr}
+	first, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	second, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	readAll(t, first)
+	readAll(t, second)
+	assert.Equal(t, int32(2), conns.Load())
+	tr.mu.Lock()
+	assert.Len(t, tr.idle[connKey(first.Request.URL)], 1)
+	tr.mu.Unlock()
+
+	// Test: CloseIdleConnections
+	tr.CloseIdleConnections()
+	assert.Equal(t, "hi", get(t, c, srv.URL))
+	assert.Equal(t, int32(3), conns.Load())
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	srv, conns := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi"))
+	})
+	c := &Client{Transport: &Transport{MaxConnsPerHost: 1}}
+
+	// Test: A second request waits for the first connection to be free
+	first, err := c.Get(srv.URL)
+	require.NoError(t, err)
+
+	done := make(chan string)
+	go func() {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		done <- string(data)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("second request did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, "hi", readAll(t, first))
+	assert.Equal(t, "hi", <-done)
+	assert.Equal(t, int32(1), conns.Load())
+
+	// Test: Waiting gives up with the client timeout
+	first, err = c.Get(srv.URL)
+	require.NoError(t, err)
+	defer first.Body.Close()
+	_, err = (&Client{Timeout: 50 * time.Millisecond, Transport: c.Transport}).Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestStaleConnections(t *testing.T) {
+	url, conns := oneShotServer(t)
+	c := &Client{Transport: &Transport{}}
+
+	// Test: Idempotent requests are retried when a reused connection turns out to be closed
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, "ok", get(t, c, url))
+	assert.Equal(t, int32(2), conns.Load())
+
+	// Test: Other requests are not
+	req, err := NewRequest("POST", url, []byte("data"))
+	require.NoError(t, err)
+	_, err = c.Do(req)
+	assert.Error(t, err)
+
+	// Test: A connection the server closed while idle is dropped from the pool
+	tr := &Transport{}
+	c = &Client{Transport: tr}
+	url = rawServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi")
+	assert.Equal(t, "hi", get(t, c, url))
+	assert.Eventually(t, func() bool {
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		return len(tr.idle) == 0 && len(tr.conns) == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "hi", get(t, c, url))
+}
@@ -0,0 +1,333 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const (
+	readBufferSize = 16 * 1024
+	maxHeaderBytes = 1 << 20
+	userAgent      = "httpfromtcp"
+)
+
+var (
+	ErrBodyClosed    = errors.New("response body is closed")
+	errMalformedLine = errors.New("malformed line")
+)
+
+// writeRequest writes req with a Content-Length framed body. Without keepAlive it asks the server
+// to close the connection after responding.
+func writeRequest(w io.Writer, req *Request, keepAlive bool) error {
+	h := headers.NewHeaders()
+	for k, v := range req.Headers {
+		h[k] = v
+	}
+	if _, ok := h.Get("Host"); !ok {
+		h.Set("Host", req.URL.Host)
+	}
+	if _, ok := h.Get("User-Agent"); !ok {
+		h.Set("User-Agent", userAgent)
+	}
+	h.Del("Transfer-Encoding")
+	h.Del("Content-Length")
+	if len(req.Body) > 0 || req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH" {
+		h.Set("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	if !keepAlive {
+		h.Set("Connection", "close")
+	}
+
+	bw := bufio.NewWriter(w)
+	_, err := bw.WriteString(req.Method + " " + req.URL.RequestURI() + " HTTP/1.1\r\n")
+	if err != nil {
+		return fmt.Errorf("failed to write request line: %w", err)
+	}
+	err = response.WriteHeaders(bw, h)
+	if err != nil {
+		return err
+	}
+	_, err = bw.Write(req.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write body: %w", err)
+	}
+	err = bw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	return nil
+}
+
+// readResponse reads the status line and headers from pc, skipping interim 1xx responses,
+// and sets up the body according to its framing. The connection goes back to the pool once the
+// body has been read to the end, provided both sides want to keep it open.
+func readResponse(pc *persistConn, req *Request, keepAlive bool) (*Response, error) {
+	br := pc.br
+
+	resp := &Response{
+		Request:  req,
+		Trailers: headers.NewHeaders(),
+	}
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read status line: %w", err)
+		}
+		sl, err := response.ParseStatusLine(line)
+		if err != nil {
+			return nil, err
+		}
+		resp.Proto = "HTTP/" + sl.HttpVersion
+		resp.StatusCode = sl.StatusCode
+		resp.Reason = sl.ReasonPhrase
+		resp.Headers, resp.SetCookies, err = readHeaders(br)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == response.StatusSwitchingProtocols {
+			break
+		}
+	}
+
+	var r io.Reader
+	reusable := keepAlive && wantsKeepAlive(resp) && resp.StatusCode != response.StatusSwitchingProtocols
+	resp.ContentLength = -1
+	switch {
+	case !response.HasBody(req.Method, resp.StatusCode):
+		if cl, ok := resp.Headers.Get("Content-Length"); ok {
+			resp.ContentLength, _ = response.ParseContentLength(cl)
+		}
+		r = bytes.NewReader(nil)
+	case response.IsChunkedFraming(resp.Headers):
+		r = &chunkedReader{br: br, trailers: resp.Trailers}
+	case hasHeader(resp.Headers, "Transfer-Encoding"):
+		// some other coding: the body runs until the server closes the connection
+		r = br
+		reusable = false
+	case hasHeader(resp.Headers, "Content-Length"):
+		cl, _ := resp.Headers.Get("Content-Length")
+		n, err := response.ParseContentLength(cl)
+		if err != nil {
+			return nil, err
+		}
+		resp.ContentLength = n
+		r = &lengthReader{r: br, remaining: n}
+	default:
+		r = br
+		reusable = false
+	}
+
+	b := &body{r: r, pc: pc, reusable: reusable}
+	if !response.HasBody(req.Method, resp.StatusCode) || resp.ContentLength == 0 {
+		// nothing left to read, the connection is free right away
+		b.finish(true)
+	}
+	resp.Body = b
+	return resp, nil
+}
+
+// wantsKeepAlive reports whether the server is willing to take another request on the connection.
+func wantsKeepAlive(resp *Response) bool {
+	conn, _ := resp.Headers.Get("Connection")
+	for _, token := range headers.SplitList(conn) {
+		if strings.EqualFold(token, "close") {
+			return false
+		}
+		if strings.EqualFold(token, "keep-alive") {
+			return true
+		}
+	}
+	return resp.Proto == "HTTP/1.1"
+}
+
+// readHeaders reads header lines up to the empty line. Set-Cookie values are returned separately.
+func readHeaders(br *bufio.Reader) (headers.Headers, []string, error) {
+	h := headers.NewHeaders()
+	var cookies []string
+	read := 0
+	for {
+		line, err := br.ReadSlice('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read headers: %w", err)
+		}
+		read += len(line)
+		if read > maxHeaderBytes {
+			return nil, nil, fmt.Errorf("headers too large")
+		}
+
+		n, done, cookie, err := response.ParseHeaderLine(h, line)
+		if err != nil {
+			return nil, nil, err
+		}
+		if done {
+			return h, cookies, nil
+		}
+		if n == 0 {
+			return nil, nil, fmt.Errorf("%w in headers: %q", errMalformedLine, line)
+		}
+		if cookie != "" {
+			cookies = append(cookies, cookie)
+		}
+	}
+}
+
+// readLine reads a CRLF terminated line and returns it without the CRLF.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", errMalformedLine
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+func hasHeader(h headers.Headers, key string) bool {
+	_, ok := h.Get(key)
+	return ok
+}
+
+type body struct {
+	r        io.Reader
+	pc       *persistConn
+	reusable bool
+	closed   bool
+	done     bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	n, err := b.r.Read(p)
+	if err != nil {
+		b.finish(errors.Is(err, io.EOF))
+	}
+	return n, err
+}
+
+// Close gives up on the rest of the body, which also means giving up on the connection.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.finish(false)
+	return nil
+}
+
+// finish releases the connection once, back to the pool if the whole body was read.
+func (b *body) finish(complete bool) {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.pc.release(complete && b.reusable)
+}
+
+// lengthReader reads exactly remaining bytes and reports a short body as io.ErrUnexpectedEOF.
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (lr *lengthReader) Read(p []byte) (int, error) {
+	if lr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > lr.remaining {
+		p = p[:lr.remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if errors.Is(err, io.EOF) && lr.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if lr.remaining == 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkedReader decodes a chunked body and stores the trailers that follow the last chunk.
+type chunkedReader struct {
+	br        *bufio.Reader
+	trailers  headers.Headers
+	remaining int64
+	needCRLF  bool
+	done      bool
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if cr.done {
+		return 0, io.EOF
+	}
+	if cr.remaining == 0 {
+		err := cr.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+		if cr.done {
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.br.Read(p)
+	cr.remaining -= int64(n)
+	if cr.remaining == 0 {
+		cr.needCRLF = true
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (cr *chunkedReader) nextChunk() error {
+	if cr.needCRLF {
+		line, err := readLine(cr.br)
+		if err != nil || line != "" {
+			return fmt.Errorf("malformed chunk: missing CRLF after data")
+		}
+		cr.needCRLF = false
+	}
+
+	line, err := readLine(cr.br)
+	if err != nil {
+		return fmt.Errorf("malformed chunk size: %w", err)
+	}
+	size, err := response.ParseChunkSize(line)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		cr.remaining = size
+		return nil
+	}
+
+	// Set-Cookie isn't allowed in trailers, so any that show up are dropped
+	trailers, _, err := readHeaders(cr.br)
+	if err != nil {
+		return fmt.Errorf("malformed trailers: %w", err)
+	}
+	for k, v := range trailers {
+		cr.trailers[k] = v
+	}
+	cr.done = true
+	return nil
+}
@@ -0,0 +1,211 @@
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+const defaultMinSize = 1024
+
+type Options struct {
+	// MinSize is the smallest Content-Length worth compressing. Bodies of unknown length are always compressed.
+	MinSize int
+	// Level is passed to the gzip/zlib writers. Zero means the default level.
+	Level int
+}
+
+// skippedTypes are media types that are already compressed.
+var skippedTypes = []string{
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/octet-stream",
+	"font/woff",
+	"font/woff2",
+}
+
+// Middleware compresses responses with gzip or deflate according to the request's Accept-Encoding.
+// HEAD responses get the headers the matching GET would carry. A request that rules out identity without
+// accepting gzip or deflate gets a 406; when identity is ruled out but the response is not worth compressing,
+// it is still sent uncompressed.
+func Middleware(opts Options) server.Middleware {
+	if opts.MinSize == 0 {
+		opts.MinSize = defaultMinSize
+	}
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			acceptEncoding, _ := req.Headers.Get("Accept-Encoding")
+			head := req.RequestLine.Method == "HEAD"
+			if Negotiate(acceptEncoding) == "" && !acceptsIdentity(acceptEncoding) {
+				writeNotAcceptable(w, head)
+				return
+			}
+			w.AddFilter(filter(opts, acceptEncoding, head))
+			next(w, req)
+		}
+	}
+}
+
+func writeNotAcceptable(w *response.Writer, head bool) {
+	body := "None of the available content codings match Accept-Encoding:\ngzip\ndeflate\nidentity\n"
+	h := response.GetDefaultHeaders(len(body))
+	headers.AddVary(h, "Accept-Encoding")
+	if head {
+		err := w.WriteStatusLine(response.StatusNotAcceptable)
+		if err != nil {
+			return
+		}
+		w.WriteHeaders(h)
+		return
+	}
+	w.WriteResponse(response.StatusNotAcceptable, h, []byte(body))
+}
+
+// filter sets up compression of the response. For HEAD it only rewrites the headers, since there is no body.
+func filter(opts Options, acceptEncoding string, head bool) response.BodyFilter {
+	return func(statusCode response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+		if !shouldCompress(opts, statusCode, h) {
+			return nil
+		}
+		headers.AddVary(h, "Accept-Encoding")
+
+		encoding := Negotiate(acceptEncoding)
+		if encoding == "" {
+			return nil
+		}
+
+		h.Set("Content-Encoding", encoding)
+		h.Del("Content-Length")
+		// the compressed bytes differ from the identity representation, so a strong tag no longer holds
+		if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		if head {
+			return nil
+		}
+		if _, ok := h.Get("Transfer-Encoding"); !ok {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+
+		return func(body io.Writer) io.WriteCloser {
+			if encoding == "gzip" {
+				gw, _ := gzip.NewWriterLevel(body, opts.Level)
+				return gw
+			}
+			zw, _ := zlib.NewWriterLevel(body, opts.Level)
+			return zw
+		}
+	}
+}
+
+func shouldCompress(opts Options, statusCode response.StatusCode, h headers.Headers) bool {
+	switch {
+	case statusCode != 0 && statusCode < 200:
+		return false
+	case statusCode == response.StatusNoContent, statusCode == response.StatusNotModified, statusCode == response.StatusPartialContent:
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	if _, ok := h.Get("Content-Range"); ok {
+		return false
+	}
+	if cl, ok := h.Get("Content-Length"); ok {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < opts.MinSize {
+			return false
+		}
+	}
+
+	contentType, _ := h.Get("Content-Type")
+	parsed, _ := headers.ParseMediaType(contentType)
+	mediaType := parsed.Essence()
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	if strings.HasPrefix(mediaType, "image/") || strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/") {
+		return false
+	}
+	return !slices.Contains(skippedTypes, mediaType)
+}
+
+// Negotiate picks "gzip" or "deflate" from an Accept-Encoding value, or "" when the identity encoding should be used.
+// Higher q-values win; gzip is preferred on ties.
+func Negotiate(acceptEncoding string) string {
+	q := parseAcceptEncoding(acceptEncoding)
+	wildcard, ok := q["*"]
+	if !ok {
+		wildcard = -1
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		weight, ok := q[coding]
+		if !ok {
+			weight = max(wildcard, 0)
+		}
+		if weight > bestQ {
+			best = coding
+			bestQ = weight
+		}
+	}
+	return best
+}
+
+// acceptsIdentity reports whether an Accept-Encoding value allows an uncompressed response.
+// Identity is acceptable unless it, or the wildcard when identity is not listed, has q=0.
+func acceptsIdentity(acceptEncoding string) bool {
+	q := parseAcceptEncoding(acceptEncoding)
+	if weight, ok := q["identity"]; ok {
+		return weight > 0
+	}
+	if weight, ok := q["*"]; ok {
+		return weight > 0
+	}
+	return true
+}
+
+// parseAcceptEncoding maps each coding in an Accept-Encoding value to its q-value, with "x-gzip" read as "gzip".
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	q := map[string]float64{}
+	for _, item := range headers.SplitList(acceptEncoding) {
+		coding, params, err := headers.ParseParams(item)
+		coding = strings.ToLower(coding)
+		if err != nil || coding == "" {
+			continue
+		}
+		weight := 1.0
+		if v, ok := params["q"]; ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			weight = parsed
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		q[coding] = weight
+	}
+	return q
+}
@@ -0,0 +1,217 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	assert.Equal(t, "gzip", Negotiate("gzip, deflate, br"))
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0.5, deflate"))
+	assert.Equal(t, "gzip", Negotiate("deflate;q=0.5, gzip;q=0.5"))
+	assert.Equal(t, "gzip", Negotiate("*"))
+	assert.Equal(t, "deflate", Negotiate("gzip;q=0, *;q=0.1"))
+	assert.Equal(t, "gzip", Negotiate("x-gzip"))
+	assert.Equal(t, "", Negotiate("identity"))
+	assert.Equal(t, "", Negotiate(""))
+	assert.Equal(t, "", Negotiate("gzip;q=0, deflate;q=0"))
+	assert.Equal(t, "", Negotiate("gzip;q=bogus"))
+
+	assert.True(t, acceptsIdentity(""))
+	assert.True(t, acceptsIdentity("gzip;q=0"))
+	assert.True(t, acceptsIdentity("*;q=0, identity"))
+	assert.False(t, acceptsIdentity("identity;q=0"))
+	assert.False(t, acceptsIdentity("gzip, *;q=0"))
+}
+
+// run sends the request through the middleware and parses the result with net/http for an independent check.
+func run(t *testing.T, h server.Handler, reqText string) (*http.Response, []byte) {
+	req, err := request.RequestFromReader(strings.NewReader(reqText))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := &response.Writer{W: &buf}
+	Middleware(Options{MinSize: 16})(h)(w, req)
+	require.NoError(t, w.Close())
+
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestMiddleware(t *testing.T) {
+	text := strings.Repeat("compressible text ", 100)
+	textHandler := func(w *response.Writer, _ *request.Request) {
+		h := response.GetDefaultHeaders(len(text))
+		h.Set("ETag", `"v1"`)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(text))
+	}
+
+	// Test: gzip with Content-Length replaced by chunked framing
+	resp, body := run(t, textHandler, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(plain))
+
+	// Test: deflate
+	resp, body = run(t, textHandler, "GET / HTTP/1.1\r\nAccept-Encoding: deflate\r\n\r\n")
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+	zr, err := zlib.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(plain))
+
+	// Test: No Accept-Encoding leaves the body alone but still sets Vary
+	resp, body = run(t, textHandler, "GET / HTTP/1.1\r\n\r\n")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, strconv.Itoa(len(text)), resp.Header.Get("Content-Length"))
+	assert.Equal(t, text, string(body))
+
+	// Test: Tiny bodies are not compressed
+	tiny := func(w *response.Writer, _ *request.Request) {
+		w.WriteResponse(response.StatusOk, nil, []byte("tiny"))
+	}
+	resp, body = run(t, tiny, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "tiny", string(body))
+
+	// Test: Already compressed media types are skipped
+	video := func(w *response.Writer, _ *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Content-Type", "video/mp4")
+		w.WriteResponse(response.StatusOk, h, bytes.Repeat([]byte{1}, 100))
+	}
+	resp, _ = run(t, video, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	// Test: Handler-chunked bodies and trailers survive compression
+	chunked := func(w *response.Writer, _ *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Done")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte(text[:500]))
+		w.WriteChunkedBody([]byte(text[500:]))
+		w.WriteChunkedBodyDone()
+		h.Set("X-Done", "yes")
+		w.WriteTrailers(h)
+	}
+	resp, body = run(t, chunked, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "yes", resp.Trailer.Get("X-Done"))
+	gr, err = gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	plain, err = io.ReadAll(gr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(plain))
+
+	// Test: HEAD is negotiated like GET but gets no body
+	head := func(w *response.Writer, _ *request.Request) {
+		h := response.GetDefaultHeaders(len(text))
+		h.Set("ETag", `"v1"`)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+	}
+	resp, body = run(t, head, "HEAD / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+	assert.Empty(t, resp.Header.Get("Content-Length"))
+	assert.Empty(t, resp.TransferEncoding)
+	assert.Empty(t, body)
+	resp, _ = run(t, head, "HEAD / HTTP/1.1\r\n\r\n")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, strconv.Itoa(len(text)), resp.Header.Get("Content-Length"))
+
+	// Test: Ruling out identity without accepting a supported coding is a 406
+	for _, ae := range []string{"identity;q=0", "br, *;q=0", "gzip;q=0, deflate;q=0, identity;q=0"} {
+		resp, body = run(t, textHandler, "GET / HTTP/1.1\r\nAccept-Encoding: "+ae+"\r\n\r\n")
+		assert.Equal(t, 406, resp.StatusCode, ae)
+		assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+		assert.Contains(t, string(body), "gzip")
+	}
+	resp, body = run(t, textHandler, "HEAD / HTTP/1.1\r\nAccept-Encoding: identity;q=0\r\n\r\n")
+	assert.Equal(t, 406, resp.StatusCode)
+	assert.Empty(t, body)
+	resp, _ = run(t, textHandler, "GET / HTTP/1.1\r\nAccept-Encoding: gzip, identity;q=0\r\n\r\n")
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	// Test: 304 is untouched
+	notModified := func(w *response.Writer, _ *request.Request) {
+		w.WriteNotModified(response.GetDefaultHeaders(0))
+	}
+	resp, _ = run(t, notModified, "GET / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.Equal(t, 304, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+}
+
+func TestDecodeRequest(t *testing.T) {
+	var got []byte
+	echo := func(w *response.Writer, req *request.Request) {
+		got = req.Body
+		w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+	}
+	handler := DecodeRequest(DecodeOptions{MaxDecodedSize: 1024})(echo)
+
+	send := func(encoding string, body []byte) string {
+		req, err := request.RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Encoding: " + encoding +
+			"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + string(body)))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		handler(&response.Writer{W: &buf}, req)
+		return buf.String()
+	}
+
+	// Test: gzip body reaches the handler decoded
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte("hello telemetry"))
+	gw.Close()
+	resp := send("gzip", buf.Bytes())
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, "hello telemetry", string(got))
+
+	// Test: Unknown coding is rejected with 415
+	resp = send("br", []byte("xx"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 415 Unsupported Media Type\r\n"))
+	assert.Contains(t, resp, "accept-encoding: gzip, deflate\r\n")
+
+	// Test: Oversized output is rejected with 413
+	buf.Reset()
+	gw = gzip.NewWriter(&buf)
+	gw.Write(make([]byte, 4096))
+	gw.Close()
+	resp = send("gzip", buf.Bytes())
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: Corrupt body is a 400
+	resp = send("gzip", []byte("garbage"))
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 400 Bad Request\r\n"))
+}
@@ -0,0 +1,45 @@
+package compression
+
+import (
+	"errors"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+const defaultMaxDecodedSize = 10 << 20
+
+type DecodeOptions struct {
+	// MaxDecodedSize caps the decompressed body size, checked while inflating. Zero means 10 MiB.
+	// The compressed body itself has already been read whole by the parser and is not limited here.
+	MaxDecodedSize int64
+}
+
+// DecodeRequest decompresses gzip/deflate request bodies before the handler sees them.
+// Unknown codings are answered with 415, bodies that inflate past the limit with 413.
+func DecodeRequest(opts DecodeOptions) server.Middleware {
+	if opts.MaxDecodedSize == 0 {
+		opts.MaxDecodedSize = defaultMaxDecodedSize
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			err := req.DecodeBody(opts.MaxDecodedSize)
+			switch {
+			case errors.Is(err, request.ErrUnsupportedEncoding):
+				h := response.GetDefaultHeaders(0)
+				h.Set("Accept-Encoding", "gzip, deflate")
+				w.WriteResponse(response.StatusUnsupportedMediaType, h, []byte(err.Error()+"\n"))
+				return
+			case errors.Is(err, request.ErrBodyTooLarge):
+				w.WriteResponse(response.StatusContentTooLarge, nil, []byte(err.Error()+"\n"))
+				return
+			case err != nil:
+				w.WriteResponse(response.StatusBadRequest, nil, []byte(err.Error()+"\n"))
+				return
+			}
+			next(w, req)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const (
+	indexFile = "index.html"
+	sniffLen  = 512
+)
+
+type FileServer struct {
+	root string
+
+	// Prefix is stripped from the request target before it is mapped onto the root directory.
+	Prefix string
+	// ListDirectories renders an HTML listing for directories without an index.html.
+	ListDirectories bool
+	// ServeDotFiles serves files and directories whose names start with a dot, such as .env or .git.
+	// By default they answer 404 and are left out of listings.
+	ServeDotFiles bool
+}
+
+// New returns a FileServer serving the directory tree at root.
+func New(root string) (*FileServer, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %v", err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %v", err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat root: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("root %s is not a directory", root)
+	}
+	return &FileServer{root: resolved}, nil
+}
+
+func (fsrv *FileServer) Handle(w *response.Writer, req *request.Request) {
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Allow", "GET, HEAD")
+		writeError(w, req, response.StatusMethodNotAllowed, h)
+		return
+	}
+
+	target := req.Path()
+	rawPath, ok := fsrv.stripPrefix(target)
+	if !ok {
+		writeError(w, req, response.StatusNotFound, nil)
+		return
+	}
+	if !strings.HasPrefix(rawPath, "/") {
+		rawPath = "/" + rawPath
+	}
+
+	urlPath, err := url.PathUnescape(rawPath)
+	if err != nil || strings.ContainsRune(urlPath, 0) {
+		writeError(w, req, response.StatusBadRequest, nil)
+		return
+	}
+	if slices.Contains(strings.Split(urlPath, "/"), "..") || strings.Contains(urlPath, "\\") {
+		writeError(w, req, response.StatusForbidden, nil)
+		return
+	}
+
+	name, err := fsrv.resolve(path.Clean(urlPath))
+	if err != nil {
+		writeFSError(w, req, err)
+		return
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		writeFSError(w, req, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			h := response.GetDefaultHeaders(0)
+			h.Set("Location", target+"/")
+			writeError(w, req, response.StatusMovedPermanently, h)
+			return
+		}
+
+		index, err := fsrv.resolve(path.Join(path.Clean(urlPath), indexFile))
+		if err == nil {
+			indexInfo, err := os.Stat(index)
+			if err == nil && !indexInfo.IsDir() {
+				ServeFile(w, req, index)
+				return
+			}
+		} else if errors.Is(err, errOutsideRoot) {
+			writeError(w, req, response.StatusForbidden, nil)
+			return
+		}
+
+		if !fsrv.ListDirectories {
+			writeError(w, req, response.StatusForbidden, nil)
+			return
+		}
+		serveDirectory(w, req, name, urlPath, fsrv.ServeDotFiles)
+		return
+	}
+
+	ServeFile(w, req, name)
+}
+
+// stripPrefix removes Prefix from target, which only matches whole path segments:
+// "/static" matches "/static" and "/static/a" but not "/staticfoo".
+func (fsrv *FileServer) stripPrefix(target string) (string, bool) {
+	rest, ok := strings.CutPrefix(target, fsrv.Prefix)
+	if !ok {
+		return "", false
+	}
+	if rest != "" && rest[0] != '/' && !strings.HasSuffix(fsrv.Prefix, "/") {
+		return "", false
+	}
+	return rest, true
+}
+
+var errOutsideRoot = errors.New("path escapes root directory")
+
+// resolve maps a cleaned URL path onto the file system and makes sure that,
+// after following symlinks, it still lives inside the root directory.
+func (fsrv *FileServer) resolve(urlPath string) (string, error) {
+	name := filepath.Join(fsrv.root, filepath.FromSlash(urlPath))
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	if resolved != fsrv.root && !strings.HasPrefix(resolved, fsrv.root+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	// checked on the resolved path too, so that a symlink cannot expose a dotfile under another name
+	if !fsrv.ServeDotFiles && (isHidden(urlPath) || isHidden(filepath.ToSlash(strings.TrimPrefix(resolved, fsrv.root)))) {
+		return "", fs.ErrNotExist
+	}
+	return resolved, nil
+}
+
+// isHidden reports whether any segment of the slash-separated path p starts with a dot.
+func isHidden(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeFile streams the named file to w. The caller is responsible for name being safe to serve.
+func ServeFile(w *response.Writer, req *request.Request, name string) {
+	f, err := os.Open(name)
+	if err != nil {
+		writeFSError(w, req, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, req, err)
+		return
+	}
+	if info.IsDir() {
+		writeError(w, req, response.StatusForbidden, nil)
+		return
+	}
+
+	contentType, err := DetectContentType(f, name)
+	if err != nil {
+		writeError(w, req, response.StatusInternalError, nil)
+		return
+	}
+
+	h := response.GetDefaultHeaders(0)
+	h.Set("Content-Type", contentType)
+	h.Set("Accept-Ranges", "bytes")
+
+	size := info.Size()
+	etag := response.WeakETag(info.ModTime(), size)
+	response.SetValidators(h, etag, info.ModTime())
+	if w.WritePreconditions(req, h) {
+		return
+	}
+
+	// range handling is only defined for GET
+	rangeHeader, hasRange := req.Headers.Get("Range")
+	if hasRange && req.RequestLine.Method == "GET" && response.IfRangeMatches(req, etag, info.ModTime()) {
+		ranges, err := ParseRange(rangeHeader, size)
+		switch {
+		case errors.Is(err, ErrUnsatisfiableRange):
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			writeError(w, req, response.StatusRangeNotSatisfiable, h)
+			return
+		case err == nil && len(ranges) == 1:
+			serveRange(w, f, h, ranges[0], size)
+			return
+		case err == nil:
+			serveMultipartRanges(w, f, h, ranges, size)
+			return
+		}
+	}
+
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	err = w.WriteStatusLine(response.StatusOk)
+	if err != nil {
+		return
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return
+	}
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	io.Copy(w, f)
+}
+
+// DetectContentType picks a media type from the file extension, falling back to sniffing the first bytes of f.
+// f is rewound to the start afterwards.
+func DetectContentType(f io.ReadSeeker, name string) (string, error) {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func serveDirectory(w *response.Writer, req *request.Request, dir, urlPath string, dotFiles bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		writeFSError(w, req, err)
+		return
+	}
+
+	var sb strings.Builder
+	title := html.EscapeString(urlPath)
+	sb.WriteString("<html><head><title>Index of " + title + "</title></head><body><h1>Index of " + title + "</h1><ul>\n")
+	if urlPath != "/" {
+		sb.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !dotFiles && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		link := "./" + (&url.URL{Path: name}).EscapedPath()
+		sb.WriteString("<li><a href=\"" + html.EscapeString(link) + "\">" + html.EscapeString(name) + "</a></li>\n")
+	}
+	sb.WriteString("</ul></body></html>\n")
+
+	h := response.GetDefaultHeaders(0)
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	body := []byte(sb.String())
+	if req.RequestLine.Method == "HEAD" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		return
+	}
+	w.WriteResponse(response.StatusOk, h, body)
+}
+
+func writeFSError(w *response.Writer, req *request.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeError(w, req, response.StatusNotFound, nil)
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, errOutsideRoot):
+		writeError(w, req, response.StatusForbidden, nil)
+	default:
+		writeError(w, req, response.StatusInternalError, nil)
+	}
+}
+
+func writeError(w *response.Writer, req *request.Request, code response.StatusCode, h headers.Headers) {
+	if h == nil {
+		h = response.GetDefaultHeaders(0)
+	}
+	h.Set("Content-Type", "text/html")
+	text := strconv.Itoa(int(code)) + " " + response.StatusText(code)
+	body := "<html><head><title>" + text + "</title></head><body><h1>" + text + "</h1></body></html>\n"
+	if req.RequestLine.Method == "HEAD" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		err := w.WriteStatusLine(code)
+		if err != nil {
+			return
+		}
+		w.WriteHeaders(h)
+		return
+	}
+	w.WriteResponse(code, h, []byte(body))
+}
@@ -0,0 +1,168 @@
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, fsrv *FileServer, method, target string) string {
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	fsrv.Handle(&response.Writer{W: &buf}, req)
+	return buf.String()
+}
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello world"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "noext"), []byte("<html><body>sniffed</body></html>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "site", "index.html"), []byte("<h1>index</h1>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "a b.txt"), []byte("spaced"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "escape.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "hello.txt"), filepath.Join(root, "link.txt")))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".git", "config"), []byte("git"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", ".env"), []byte("SECRET=1"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "sub", ".env"), filepath.Join(root, "env.txt")))
+
+	fsrv, err := New(root)
+	require.NoError(t, err)
+
+	// Test: Regular file with extension-based Content-Type
+	resp := serve(t, fsrv, "GET", "/hello.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "content-type: text/plain; charset=utf-8\r\n")
+	assert.Contains(t, resp, "content-length: 11\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\nhello world"))
+
+	// Test: Content-Type sniffed when there is no extension
+	resp = serve(t, fsrv, "GET", "/noext")
+	assert.Contains(t, resp, "content-type: text/html; charset=utf-8\r\n")
+
+	// Test: HEAD has no body
+	resp = serve(t, fsrv, "HEAD", "/hello.txt")
+	assert.Contains(t, resp, "content-length: 11\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Missing file
+	resp = serve(t, fsrv, "GET", "/missing.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: HEAD errors have no body either
+	resp = serve(t, fsrv, "HEAD", "/missing.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: Path traversal is rejected
+	resp = serve(t, fsrv, "GET", "/../secret.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+	resp = serve(t, fsrv, "GET", "/sub/%2e%2e/%2e%2e/secret.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+
+	// Test: Symlink escaping the root is rejected, one inside the root is served
+	resp = serve(t, fsrv, "GET", "/escape.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+	resp = serve(t, fsrv, "GET", "/link.txt")
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+
+	// Test: Dotfiles and dot directories are hidden by default, also behind a symlink
+	for _, target := range []string{"/sub/.env", "/.git/config", "/.git/", "/sub/%2eenv", "/env.txt"} {
+		resp = serve(t, fsrv, "GET", target)
+		assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"), target)
+	}
+
+	// Test: Directory without trailing slash is redirected
+	resp = serve(t, fsrv, "GET", "/site")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, resp, "location: /site/\r\n")
+
+	// Test: index.html is served for directories
+	resp = serve(t, fsrv, "GET", "/site/")
+	assert.True(t, strings.HasSuffix(resp, "<h1>index</h1>"))
+
+	// Test: Directory listing is forbidden by default
+	resp = serve(t, fsrv, "GET", "/sub/")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 403 Forbidden\r\n"))
+
+	// Test: Directory listing when enabled
+	fsrv.ListDirectories = true
+	resp = serve(t, fsrv, "GET", "/sub/")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, `<a href="./a%20b.txt">a b.txt</a>`)
+	assert.NotContains(t, resp, ".env")
+
+	// Test: Dotfiles are served and listed when enabled
+	fsrv.ServeDotFiles = true
+	resp = serve(t, fsrv, "GET", "/sub/")
+	assert.Contains(t, resp, `<a href="./.env">.env</a>`)
+	resp = serve(t, fsrv, "GET", "/sub/.env")
+	assert.True(t, strings.HasSuffix(resp, "SECRET=1"))
+	fsrv.ServeDotFiles = false
+
+	// Test: Percent-encoded names are decoded
+	resp = serve(t, fsrv, "GET", "/sub/a%20b.txt")
+	assert.True(t, strings.HasSuffix(resp, "spaced"))
+
+	// Test: Prefix is stripped
+	fsrv.Prefix = "/static"
+	resp = serve(t, fsrv, "GET", "/static/hello.txt?v=1")
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+
+	// Test: Prefix only matches whole path segments
+	resp = serve(t, fsrv, "GET", "/staticfoo/hello.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n"))
+	fsrv.Prefix = "/static/"
+	resp = serve(t, fsrv, "GET", "/static/hello.txt")
+	assert.True(t, strings.HasSuffix(resp, "hello world"))
+	fsrv.Prefix = "/static"
+
+	// Test: Unsupported method
+	resp = serve(t, fsrv, "POST", "/static/hello.txt")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, resp, "allow: GET, HEAD\r\n")
+}
+
+func TestDetectContentType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want string
+	}{
+		{"page.html", "anything", "text/html; charset=utf-8"},
+		{"style.css", "anything", "text/css; charset=utf-8"},
+		{"noext", "  <!doctype html><html></html>", "text/html; charset=utf-8"},
+		{"noext", "<p>paragraph</p>", "text/html; charset=utf-8"},
+		{"noext", "<pre>not a tag we know</pre>", "text/plain; charset=utf-8"},
+		{"noext", "<?xml version=\"1.0\"?><a/>", "text/xml; charset=utf-8"},
+		{"noext", "\x89PNG\r\n\x1a\n\x00\x00", "image/png"},
+		{"noext", "RIFF\x00\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"noext", "%PDF-1.7", "application/pdf"},
+		{"noext", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom", "video/mp4"},
+		{"noext", "\x1A\x45\xDF\xA3\x01\x00\x00\x00", "video/webm"},
+		{"noext", "ID3\x03\x00\x00\x00\x00", "audio/mpeg"},
+		{"noext", "RIFF\x00\x00\x00\x00WAVEfmt ", "audio/wave"},
+		{"noext", "wOF2\x00\x01\x00\x00", "font/woff2"},
+		{"noext", "plain text\nwith lines\n", "text/plain; charset=utf-8"},
+		{"noext", "", "text/plain; charset=utf-8"},
+		{"noext", "\x00\x01\x02binary", "application/octet-stream"},
+	} {
+		f := strings.NewReader(tc.data)
+		ct, err := DetectContentType(f, tc.name)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, ct, "%s %q", tc.name, tc.data)
+		assert.Equal(t, int64(len(tc.data)), int64(f.Len()), "not rewound")
+	}
+}
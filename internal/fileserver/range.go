@@ -0,0 +1,211 @@
+package fileserver
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const maxRanges = 64
+
+var (
+	ErrInvalidRange       = errors.New("invalid range")
+	ErrUnsatisfiableRange = errors.New("range not satisfiable")
+)
+
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header value such as "bytes=0-99, 200-, -50" against a representation of size bytes.
+// Ranges that start past the end are dropped; ErrUnsatisfiableRange is returned when none are left.
+// Overlapping and adjacent ranges are merged, so the result is sorted and never adds up to more than size bytes.
+// Any syntax error or an unknown range unit yields ErrInvalidRange, in which case the header should be ignored.
+func ParseRange(s string, size int64) ([]ByteRange, error) {
+	unit, set, found := strings.Cut(s, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, ErrInvalidRange
+	}
+
+	specs := strings.Split(set, ",")
+	if len(specs) > maxRanges {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []ByteRange
+	seen := 0
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		seen++
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, ErrInvalidRange
+		}
+		first = strings.TrimSpace(first)
+		last = strings.TrimSpace(last)
+
+		if first == "" {
+			// suffix range: the last n bytes
+			n, err := parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				continue
+			}
+			n = min(n, size)
+			if n == 0 {
+				continue
+			}
+			ranges = append(ranges, ByteRange{Start: size - n, Length: n})
+			continue
+		}
+
+		start, err := parseRangeInt(first)
+		if err != nil {
+			return nil, err
+		}
+		end := size - 1
+		if last != "" {
+			end, err = parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, ErrInvalidRange
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, ByteRange{Start: start, Length: end - start + 1})
+	}
+
+	if seen == 0 {
+		return nil, ErrInvalidRange
+	}
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+	return coalesce(ranges), nil
+}
+
+// coalesce sorts ranges by start and merges the ones that overlap or touch.
+func coalesce(ranges []ByteRange) []ByteRange {
+	slices.SortFunc(ranges, func(a, b ByteRange) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start > last.Start+last.Length {
+			merged = append(merged, r)
+			continue
+		}
+		last.Length = max(last.Length, r.Start+r.Length-last.Start)
+	}
+	return merged
+}
+
+func parseRangeInt(s string) (int64, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, ErrInvalidRange
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidRange
+	}
+	return n, nil
+}
+
+func serveRange(w *response.Writer, f io.ReadSeeker, h headers.Headers, r ByteRange, size int64) {
+	h.Set("Content-Range", r.ContentRange(size))
+	h.Set("Content-Length", strconv.FormatInt(r.Length, 10))
+
+	err := w.WriteStatusLine(response.StatusPartialContent)
+	if err != nil {
+		return
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return
+	}
+	_, err = f.Seek(r.Start, io.SeekStart)
+	if err != nil {
+		return
+	}
+	io.CopyN(w, f, r.Length)
+}
+
+// serveMultipartRanges sends several ranges as a multipart/byteranges body.
+func serveMultipartRanges(w *response.Writer, f io.ReadSeeker, h headers.Headers, ranges []ByteRange, size int64) {
+	boundary := randomBoundary()
+	contentType, _ := h.Get("Content-Type")
+
+	partHeaders := make([]string, len(ranges))
+	var total int64
+	for i, r := range ranges {
+		partHeaders[i] = "--" + boundary + "\r\n" +
+			"Content-Type: " + contentType + "\r\n" +
+			"Content-Range: " + r.ContentRange(size) + "\r\n\r\n"
+		total += int64(len(partHeaders[i])) + r.Length + 2
+	}
+	closing := "--" + boundary + "--\r\n"
+	total += int64(len(closing))
+
+	mediaType := headers.MediaType{Type: "multipart", Subtype: "byteranges", Params: map[string]string{"boundary": boundary}}
+	h.Set("Content-Type", mediaType.String())
+	h.Set("Content-Length", strconv.FormatInt(total, 10))
+
+	err := w.WriteStatusLine(response.StatusPartialContent)
+	if err != nil {
+		return
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return
+	}
+	for i, r := range ranges {
+		_, err = w.Write([]byte(partHeaders[i]))
+		if err != nil {
+			return
+		}
+		_, err = f.Seek(r.Start, io.SeekStart)
+		if err != nil {
+			return
+		}
+		_, err = io.CopyN(w, f, r.Length)
+		if err != nil {
+			return
+		}
+		_, err = w.Write([]byte("\r\n"))
+		if err != nil {
+			return
+		}
+	}
+	w.Write([]byte(closing))
+}
+
+func randomBoundary() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package fileserver
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: Single closed range
+	ranges, err := ParseRange("bytes=0-9", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 10}}, ranges)
+
+	// Test: Open-ended and suffix ranges
+	ranges, err = ParseRange("bytes=10-, -5", 20)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 10, Length: 10}}, ranges)
+	ranges, err = ParseRange("bytes=90-, -5", 200)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 90, Length: 110}}, ranges)
+
+	// Test: End past the size is clamped
+	ranges, err = ParseRange("bytes=50-1000", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 50, Length: 50}}, ranges)
+
+	// Test: Suffix longer than the size selects everything
+	ranges, err = ParseRange("bytes=-500", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 100}}, ranges)
+
+	// Test: Unsatisfiable ranges are dropped
+	ranges, err = ParseRange("bytes=200-300, 0-0", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 1}}, ranges)
+
+	// Test: Overlapping and adjacent ranges are merged and sorted, disjoint ones are kept
+	ranges, err = ParseRange("bytes=50-59, 0-9, 5-19, 20-29, 40-44", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 30}, {Start: 40, Length: 5}, {Start: 50, Length: 10}}, ranges)
+
+	// Test: Repeating a range cannot multiply the response
+	ranges, err = ParseRange("bytes="+strings.Repeat("0-,", maxRanges-1)+"0-", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 100}}, ranges)
+
+	// Test: Nothing satisfiable
+	_, err = ParseRange("bytes=100-", 100)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+	_, err = ParseRange("bytes=-0", 100)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+
+	// Test: Syntax errors
+	for _, s := range []string{"bytes=5-1", "bytes=a-b", "items=0-1", "bytes=", "bytes=1", "bytes=+1-2", "0-1"} {
+		_, err = ParseRange(s, 100)
+		assert.ErrorIs(t, err, ErrInvalidRange, s)
+	}
+}
+
+func serveWithHeaders(t *testing.T, name string, hdrs string) string {
+	req, err := request.RequestFromReader(strings.NewReader("GET /file HTTP/1.1\r\nHost: localhost\r\n" + hdrs + "\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	ServeFile(&response.Writer{W: &buf}, req, name)
+	return buf.String()
+}
+
+func TestServeFileRanges(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "digits.txt")
+	require.NoError(t, os.WriteFile(name, []byte("0123456789"), 0o644))
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+
+	// Test: Accept-Ranges is advertised on full responses
+	resp := serveWithHeaders(t, name, "")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, resp, "accept-ranges: bytes\r\n")
+
+	// Test: Single range
+	resp = serveWithHeaders(t, name, "Range: bytes=2-4\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "content-range: bytes 2-4/10\r\n")
+	assert.Contains(t, resp, "content-length: 3\r\n")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n234"))
+
+	// Test: Multiple ranges as multipart/byteranges
+	resp = serveWithHeaders(t, name, "Range: bytes=0-1, -2\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, resp, "content-type: multipart/byteranges; boundary=")
+	assert.Contains(t, resp, "Content-Range: bytes 0-1/10\r\n\r\n01\r\n")
+	assert.Contains(t, resp, "Content-Range: bytes 8-9/10\r\n\r\n89\r\n")
+	_, body, _ := strings.Cut(resp, "\r\n\r\n")
+	assert.Contains(t, resp, "content-length: "+strconv.Itoa(len(body))+"\r\n")
+
+	// Test: Unsatisfiable range
+	resp = serveWithHeaders(t, name, "Range: bytes=20-\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, resp, "content-range: bytes */10\r\n")
+
+	// Test: Invalid range is ignored
+	resp = serveWithHeaders(t, name, "Range: bytes=4-2\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Range with a matching date honours the range
+	resp = serveWithHeaders(t, name, "Range: bytes=0-0\r\nIf-Range: "+modTime.Format(http.TimeFormat)+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 206 Partial Content\r\n"))
+
+	// Test: If-Range with a stale date sends the whole file
+	resp = serveWithHeaders(t, name, "Range: bytes=0-0\r\nIf-Range: "+modTime.Add(-time.Hour).Format(http.TimeFormat)+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "0123456789"))
+
+	// Test: Validators are sent and revalidation yields 304
+	resp = serveWithHeaders(t, name, "")
+	etag := response.WeakETag(modTime, 10)
+	assert.Contains(t, resp, "etag: "+etag+"\r\n")
+	assert.Contains(t, resp, "last-modified: "+modTime.Format(http.TimeFormat)+"\r\n")
+	resp = serveWithHeaders(t, name, "If-None-Match: "+etag+"\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+}
@@ -0,0 +1,184 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cookieTimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a cookie as sent in a Set-Cookie response header.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is in seconds. Zero leaves the attribute out, a negative value deletes the cookie (Max-Age=0).
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+var (
+	ErrInvalidCookieName  = errors.New("invalid cookie name")
+	ErrInvalidCookieValue = errors.New("invalid cookie value")
+)
+
+// Valid reports whether the cookie can be sent as-is.
+func (c *Cookie) Valid() error {
+	if c.Name == "" || !isToken(c.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidCookieName, c.Name)
+	}
+	if !validCookieValue(c.Value) {
+		return fmt.Errorf("%w: %q", ErrInvalidCookieValue, c.Value)
+	}
+	if !validAttributeValue(c.Path) {
+		return fmt.Errorf("invalid cookie path: %q", c.Path)
+	}
+	if !validCookieDomain(c.Domain) {
+		return fmt.Errorf("invalid cookie domain: %q", c.Domain)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return errors.New("cookie with SameSite=None must be Secure")
+	}
+	if c.Partitioned && !c.Secure {
+		return errors.New("partitioned cookie must be Secure")
+	}
+	return nil
+}
+
+// String formats the cookie as a Set-Cookie value. It does not validate; call Valid first.
+func (c *Cookie) String() string {
+	var sb strings.Builder
+	sb.WriteString(c.Name + "=" + c.Value)
+	if c.Path != "" {
+		sb.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		sb.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		sb.WriteString("; Expires=" + c.Expires.UTC().Format(cookieTimeFormat))
+	}
+	if c.MaxAge > 0 {
+		sb.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		sb.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		sb.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		sb.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		sb.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		sb.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		sb.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		sb.WriteString("; Partitioned")
+	}
+	return sb.String()
+}
+
+// ParseCookies parses a Cookie request header into a name -> value map.
+// Malformed pairs are skipped and the first occurrence of a name wins.
+func ParseCookies(s string) map[string]string {
+	cookies := map[string]string{}
+	// ',' can't appear in a cookie-octet, and Parse joins repeated Cookie lines with ", "
+	pairs := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ','
+	})
+	for _, pair := range pairs {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || name == "" || !isToken(name) {
+			continue
+		}
+		if !validCookieValue(value) {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if _, ok := cookies[name]; !ok {
+			cookies[name] = value
+		}
+	}
+	return cookies
+}
+
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// validCookieValue checks for *cookie-octet, optionally wrapped in double quotes (RFC 6265 section 4.1.1).
+func validCookieValue(v string) bool {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func validAttributeValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] == 0x7f || v[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+func validCookieDomain(d string) bool {
+	d = strings.TrimPrefix(d, ".")
+	if len(d) > 255 {
+		return false
+	}
+	for i := 0; i < len(d); i++ {
+		c := d[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
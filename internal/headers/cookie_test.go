@@ -0,0 +1,60 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieString(t *testing.T) {
+	// Test: All attributes
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2025, time.March, 4, 5, 6, 7, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	assert.NoError(t, c.Valid())
+	assert.Equal(t, "session=abc123; Path=/; Domain=example.com; Expires=Tue, 04 Mar 2025 05:06:07 GMT; "+
+		"Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Deleting a cookie
+	c = &Cookie{Name: "session", MaxAge: -1, SameSite: SameSiteLax}
+	assert.NoError(t, c.Valid())
+	assert.Equal(t, "session=; Max-Age=0; SameSite=Lax", c.String())
+
+	// Test: Validation
+	assert.ErrorIs(t, (&Cookie{Name: "bad name", Value: "x"}).Valid(), ErrInvalidCookieName)
+	assert.ErrorIs(t, (&Cookie{Name: "", Value: "x"}).Valid(), ErrInvalidCookieName)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "x;y"}).Valid(), ErrInvalidCookieValue)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "x y"}).Valid(), ErrInvalidCookieValue)
+	assert.NoError(t, (&Cookie{Name: "a", Value: `"quoted"`}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Path: "/x;evil"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Domain: "exa mple.com"}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", SameSite: SameSiteNone}).Valid())
+	assert.Error(t, (&Cookie{Name: "a", Partitioned: true}).Valid())
+}
+
+func TestParseCookies(t *testing.T) {
+	// Test: Several cookies, quoted value, first occurrence wins
+	cookies := ParseCookies(`a=1; b="two"; a=3;c=`)
+	assert.Equal(t, map[string]string{"a": "1", "b": "two", "c": ""}, cookies)
+
+	// Test: Repeated Cookie lines joined by the header parser
+	cookies = ParseCookies("a=1, b=2")
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, cookies)
+
+	// Test: Malformed pairs are skipped
+	cookies = ParseCookies("noequals; bad name=1; ok=yes; v=a\\b")
+	assert.Equal(t, map[string]string{"ok": "yes"}, cookies)
+
+	// Test: Empty header
+	assert.Empty(t, ParseCookies(""))
+}
@@ -70,3 +70,22 @@ func (h Headers) Set(key, val string) (string, bool) {
 	h[strings.ToLower(key)] = val
 	return val, true
 }
+
+func (h Headers) Del(key string) {
+	delete(h, strings.ToLower(key))
+}
+
+// AddVary adds field to the Vary header unless it is already listed (or Vary is "*").
+func AddVary(h Headers, field string) {
+	vary, ok := h.Get("Vary")
+	if !ok || vary == "" {
+		h.Set("Vary", field)
+		return
+	}
+	for _, v := range SplitList(vary) {
+		if v == "*" || strings.EqualFold(v, field) {
+			return
+		}
+	}
+	h.Set("Vary", vary+", "+field)
+}
@@ -0,0 +1,178 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidMediaType = errors.New("invalid media type")
+
+// MediaType is a parsed "type/subtype; name=value" value as used by Content-Type and Accept.
+// Type, Subtype and parameter names are lowercase.
+type MediaType struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+}
+
+func ParseMediaType(s string) (MediaType, error) {
+	value, params, err := ParseParams(s)
+	if err != nil {
+		return MediaType{}, fmt.Errorf("%w: %v", ErrInvalidMediaType, err)
+	}
+	typ, subtype, found := strings.Cut(strings.ToLower(value), "/")
+	if !found || typ == "" || subtype == "" || !isToken(typ) || !isToken(subtype) {
+		return MediaType{}, fmt.Errorf("%w: %q", ErrInvalidMediaType, s)
+	}
+	return MediaType{Type: typ, Subtype: subtype, Params: params}, nil
+}
+
+// Essence returns "type/subtype" without parameters.
+func (m MediaType) Essence() string {
+	return m.Type + "/" + m.Subtype
+}
+
+// String formats the media type with its parameters in sorted order, quoting values where needed.
+func (m MediaType) String() string {
+	return FormatParams(m.Essence(), m.Params)
+}
+
+// FormatParams is the inverse of ParseParams.
+func FormatParams(value string, params map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString(value)
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		sb.WriteString("; " + name + "=" + Quote(params[name]))
+	}
+	return sb.String()
+}
+
+// ParseParams splits a structured header value like `form-data; name="field"; filename="a \"b\".txt"`
+// into its leading value and its parameters. Parameter names are lowercased, values may be tokens or
+// quoted strings, and a parameter without '=' gets an empty value.
+func ParseParams(s string) (string, map[string]string, error) {
+	value, rest, _ := strings.Cut(s, ";")
+	rest = ";" + rest
+	params := map[string]string{}
+	for {
+		rest = trimOWS(rest)
+		if rest == "" {
+			break
+		}
+		if rest[0] != ';' {
+			return "", nil, fmt.Errorf("unexpected %q in parameters", rest)
+		}
+		rest = trimOWS(rest[1:])
+		if rest == "" {
+			break
+		}
+
+		var name, val string
+		name, rest = consumeToken(rest)
+		if name == "" {
+			return "", nil, fmt.Errorf("invalid parameter name in %q", s)
+		}
+		name = strings.ToLower(name)
+		rest = trimOWS(rest)
+		if strings.HasPrefix(rest, "=") {
+			rest = trimOWS(rest[1:])
+			if strings.HasPrefix(rest, `"`) {
+				var err error
+				val, rest, err = consumeQuotedString(rest)
+				if err != nil {
+					return "", nil, err
+				}
+			} else {
+				val, rest = consumeToken(rest)
+				if val == "" {
+					return "", nil, fmt.Errorf("missing value for parameter %q", name)
+				}
+			}
+		}
+		if _, ok := params[name]; ok {
+			return "", nil, fmt.Errorf("duplicate parameter %q", name)
+		}
+		params[name] = val
+	}
+	return strings.TrimSpace(value), params, nil
+}
+
+// SplitList splits a comma-separated header value, ignoring commas inside quoted strings.
+// Elements are trimmed and empty ones dropped.
+func SplitList(s string) []string {
+	var items []string
+	start := 0
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == ',':
+			if item := strings.TrimSpace(s[start:i]); item != "" {
+				items = append(items, item)
+			}
+			start = i + 1
+		}
+	}
+	if item := strings.TrimSpace(s[min(start, len(s)):]); item != "" {
+		items = append(items, item)
+	}
+	return items
+}
+
+// Quote returns v as is if it is a token, otherwise as a quoted string.
+func Quote(v string) string {
+	if v != "" && isToken(v) {
+		return v
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if v[i] == '"' || v[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(v[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func consumeToken(s string) (token, rest string) {
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// consumeQuotedString reads a quoted-string at the start of s and returns its unescaped content.
+func consumeQuotedString(s string) (value, rest string, err error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return sb.String(), s[i+1:], nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case c < 0x20 && c != '\t' || c == 0x7f:
+			return "", "", fmt.Errorf("invalid character in quoted string")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted string")
+}
+
+func trimOWS(s string) string {
+	return strings.TrimLeft(s, " \t")
+}
@@ -0,0 +1,50 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMediaType(t *testing.T) {
+	// Test: Type and parameters are normalized
+	mt, err := ParseMediaType(`Text/HTML; Charset=utf-8`)
+	require.NoError(t, err)
+	assert.Equal(t, "text", mt.Type)
+	assert.Equal(t, "html", mt.Subtype)
+	assert.Equal(t, "text/html", mt.Essence())
+	assert.Equal(t, map[string]string{"charset": "utf-8"}, mt.Params)
+
+	// Test: Quoted strings with escapes and separators
+	mt, err = ParseMediaType(`multipart/form-data ; boundary="a;b,c \"d\"" ;x=1;`)
+	require.NoError(t, err)
+	assert.Equal(t, `a;b,c "d"`, mt.Params["boundary"])
+	assert.Equal(t, "1", mt.Params["x"])
+
+	// Test: Invalid values
+	for _, s := range []string{"", "text", "text/", "/html", "te xt/html", `text/html; a="unterminated`,
+		"text/html; a=1; a=2", "text/html; =1", "text/html; a=1 b=2", "text/html; a="} {
+		_, err := ParseMediaType(s)
+		assert.ErrorIs(t, err, ErrInvalidMediaType, s)
+	}
+
+	// Test: Parameters without a value
+	_, params, err := ParseParams("permessage-deflate; client_no_context_takeover")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"client_no_context_takeover": ""}, params)
+
+	// Test: Formatting quotes where needed and round trips
+	mt = MediaType{Type: "text", Subtype: "plain", Params: map[string]string{"charset": "utf-8", "name": `my "file"`}}
+	assert.Equal(t, `text/plain; charset=utf-8; name="my \"file\""`, mt.String())
+	parsed, err := ParseMediaType(mt.String())
+	require.NoError(t, err)
+	assert.Equal(t, mt, parsed)
+	assert.Equal(t, "application/json", MediaType{Type: "application", Subtype: "json"}.String())
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b;q=0.5", `c="x, y"`}, SplitList(` a ,b;q=0.5,, c="x, y" ,`))
+	assert.Equal(t, []string{`"a\",b"`, "c"}, SplitList(`"a\",b", c`))
+	assert.Empty(t, SplitList(" , "))
+}
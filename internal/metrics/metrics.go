@@ -0,0 +1,330 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+// ContentType is the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	DefaultSizeBuckets     = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000, 100_000_000}
+)
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds metrics and writes them out in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(sb *strings.Builder)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// desc is what every metric type shares: its name, help text, label names and one series per label value combination.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (r *Registry) register(d desc, m metric) {
+	if !nameRegexp.MatchString(d.name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", d.name))
+	}
+	for _, l := range d.labels {
+		if !nameRegexp.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", l))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[d.name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", d.name))
+	}
+	r.names[d.name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	var sb strings.Builder
+	for _, m := range metrics {
+		m.write(&sb)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Handle serves the metrics. It can be used as a server.Handler.
+func (r *Registry) Handle(w *response.Writer, req *request.Request) {
+	if req.RequestLine.Method != "GET" && req.RequestLine.Method != "HEAD" {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Allow", "GET, HEAD")
+		w.WriteResponse(response.StatusMethodNotAllowed, h, nil)
+		return
+	}
+	var sb strings.Builder
+	r.WriteText(&sb)
+	h := response.GetDefaultHeaders(0)
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-store")
+	body := []byte(sb.String())
+	if req.RequestLine.Method == "HEAD" {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		return
+	}
+	w.WriteResponse(response.StatusOk, h, body)
+}
+
+// series holds the per-label-combination values of a metric.
+type series[T any] struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*T
+	order  []string
+}
+
+func newSeries[T any](d desc) *series[T] {
+	return &series[T]{desc: d, values: map[string]*T{}}
+}
+
+// get returns the value for labelValues, creating it with init if needed. The caller must hold s.mu.
+func (s *series[T]) get(labelValues []string, init func() *T) *T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.name, len(s.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v, ok := s.values[key]
+	if !ok {
+		v = init()
+		s.values[key] = v
+		s.order = append(s.order, key)
+	}
+	return v
+}
+
+// each calls f for every series, sorted by label values. The caller must hold s.mu.
+func (s *series[T]) each(f func(labelValues []string, v *T)) {
+	keys := slices.Clone(s.order)
+	slices.Sort(keys)
+	for _, key := range keys {
+		var values []string
+		if len(s.labels) > 0 {
+			values = strings.Split(key, "\xff")
+		}
+		f(values, s.values[key])
+	}
+}
+
+func (s *series[T]) writeHeader(sb *strings.Builder) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", s.name, escapeHelp(s.help))
+	fmt.Fprintf(sb, "# TYPE %s %s\n", s.name, s.typ)
+}
+
+type Counter struct {
+	*series[float64]
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newSeries[float64](desc{name: name, help: help, typ: "counter", labels: labels})}
+	r.register(c.desc, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter. Negative values panic, counters only go up.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter decreased")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(labelValues, newFloat) += v
+}
+
+func (c *Counter) write(sb *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(sb)
+	c.each(func(lv []string, v *float64) {
+		writeSample(sb, c.name, c.labels, lv, "", "", *v)
+	})
+}
+
+type Gauge struct {
+	*series[float64]
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newSeries[float64](desc{name: name, help: help, typ: "gauge", labels: labels})}
+	r.register(g.desc, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(labelValues, newFloat) = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(labelValues, newFloat) += v
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) write(sb *strings.Builder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(sb)
+	g.each(func(lv []string, v *float64) {
+		writeSample(sb, g.name, g.labels, lv, "", "", *v)
+	})
+}
+
+type histogramValue struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+type Histogram struct {
+	*series[histogramValue]
+	buckets []float64
+}
+
+// NewHistogram creates a histogram with the given upper bucket bounds; a +Inf bucket is always added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	h := &Histogram{
+		series:  newSeries[histogramValue](desc{name: name, help: help, typ: "histogram", labels: labels}),
+		buckets: buckets,
+	}
+	r.register(h.desc, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.get(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets)+1)}
+	})
+	i, _ := slices.BinarySearch(h.buckets, v)
+	hv.counts[i]++
+	hv.sum += v
+	hv.count++
+}
+
+func (h *Histogram) write(sb *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(sb)
+	h.each(func(lv []string, v *histogramValue) {
+		var cumulative uint64
+		for i, count := range v.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = formatFloat(h.buckets[i])
+			}
+			writeSample(sb, h.name+"_bucket", h.labels, lv, "le", le, float64(cumulative))
+		}
+		writeSample(sb, h.name+"_sum", h.labels, lv, "", "", v.sum)
+		writeSample(sb, h.name+"_count", h.labels, lv, "", "", float64(v.count))
+	})
+}
+
+func newFloat() *float64 {
+	return new(float64)
+}
+
+func writeSample(sb *strings.Builder, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	sb.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		sb.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(formatFloat(v))
+	sb.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests by method.", "method", "status")
+	conns := r.NewGauge("connections", "Open connections.")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.5, 0.1, 1}, "path")
+
+	requests.Inc("POST", "201")
+	requests.Add(2, "GET", "200")
+	requests.Inc(`we"ird`+"\n", "500")
+	conns.Inc()
+	conns.Inc()
+	conns.Dec()
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+	latency.Observe(3, "/")
+
+	var sb strings.Builder
+	require.NoError(t, r.WriteText(&sb))
+	assert.Equal(t, `# HELP requests_total Requests by method.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="201"} 1
+requests_total{method="we\"ird\n",status="500"} 1
+# HELP connections Open connections.
+# TYPE connections gauge
+connections 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{path="/",le="0.1"} 1
+latency_seconds_bucket{path="/",le="0.5"} 2
+latency_seconds_bucket{path="/",le="1"} 2
+latency_seconds_bucket{path="/",le="+Inf"} 3
+latency_seconds_sum{path="/"} 3.55
+latency_seconds_count{path="/"} 3
+`, sb.String())
+
+	// Test: Misuse panics
+	assert.Panics(t, func() { requests.Inc("GET") })
+	assert.Panics(t, func() { requests.Add(-1, "GET", "200") })
+	assert.Panics(t, func() { r.NewGauge("connections", "again") })
+	assert.Panics(t, func() { r.NewGauge("bad-name", "") })
+	assert.Panics(t, func() { r.NewHistogram("h", "", nil, "le") })
+}
+
+func TestHandle(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits.").Inc()
+
+	serve := func(method string) *http.Response {
+		req, err := request.RequestFromReader(strings.NewReader(method + " /metrics HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		r.Handle(&response.Writer{W: &buf}, req)
+		resp, err := http.ReadResponse(bufio.NewReader(&buf), &http.Request{Method: method})
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := serve("GET")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "hits_total 1\n")
+
+	resp = serve("POST")
+	assert.Equal(t, 405, resp.StatusCode)
+}
@@ -0,0 +1,169 @@
+package negotiate
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+// Range is one element of an Accept, Accept-Language or Accept-Charset header.
+type Range struct {
+	Value  string
+	Params map[string]string
+	Q      float64
+}
+
+// ParseAccept parses a list of ranges with optional q-values. Invalid q-values count as 0
+// and elements that can't be parsed are dropped.
+func ParseAccept(s string) []Range {
+	var ranges []Range
+	for _, item := range headers.SplitList(s) {
+		value, params, err := headers.ParseParams(item)
+		if err != nil || value == "" {
+			continue
+		}
+		r := Range{Value: strings.ToLower(value), Params: params, Q: 1}
+		if q, ok := params["q"]; ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			r.Q = parsed
+			delete(params, "q")
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// BestContentType returns the offered media type the Accept value prefers, or "" if none is acceptable.
+// Each offer gets the q-value of the most specific range matching it; ties go to the earlier offer.
+// An empty Accept value accepts anything.
+func BestContentType(accept string, offers []string) string {
+	return best(accept, offers, mediaRangeMatch)
+}
+
+// BestLanguage does the same for Accept-Language, where "en" matches "en" and "en-GB".
+func BestLanguage(acceptLanguage string, offers []string) string {
+	return best(acceptLanguage, offers, languageMatch)
+}
+
+// BestCharset does the same for Accept-Charset.
+func BestCharset(acceptCharset string, offers []string) string {
+	return best(acceptCharset, offers, func(r Range, offer string) int {
+		switch {
+		case r.Value == "*":
+			return 1
+		case strings.EqualFold(r.Value, offer):
+			return 2
+		}
+		return 0
+	})
+}
+
+// matchFunc returns how specifically r matches offer, 0 meaning no match.
+type matchFunc func(r Range, offer string) int
+
+func best(accept string, offers []string, match matchFunc) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	ranges := ParseAccept(accept)
+	bestOffer := ""
+	bestQ := 0.0
+	for _, offer := range offers {
+		q := 0.0
+		specificity := 0
+		for _, r := range ranges {
+			s := match(r, offer)
+			if s > specificity {
+				specificity = s
+				q = r.Q
+			}
+		}
+		if q > bestQ {
+			bestOffer = offer
+			bestQ = q
+		}
+	}
+	return bestOffer
+}
+
+func mediaRangeMatch(r Range, offer string) int {
+	mt, err := headers.ParseMediaType(offer)
+	if err != nil {
+		return 0
+	}
+	typ, subtype, _ := strings.Cut(r.Value, "/")
+	switch {
+	case typ == "*" && subtype == "*":
+		return 1
+	case typ != mt.Type:
+		return 0
+	case subtype == "*":
+		return 2
+	case subtype != mt.Subtype:
+		return 0
+	}
+	if len(r.Params) == 0 {
+		return 3
+	}
+	for k, v := range r.Params {
+		if !strings.EqualFold(mt.Params[k], v) {
+			return 0
+		}
+	}
+	return 4
+}
+
+func languageMatch(r Range, offer string) int {
+	if r.Value == "*" {
+		return 1
+	}
+	offer = strings.ToLower(offer)
+	if offer == r.Value || strings.HasPrefix(offer, r.Value+"-") {
+		// longer ranges are more specific
+		return 1 + len(r.Value)
+	}
+	return 0
+}
+
+// ContentType picks one of offers for the request's Accept header and marks the response as varying on Accept.
+// If nothing is acceptable it writes a 406 response listing the offers and returns false.
+func ContentType(w *response.Writer, req *request.Request, offers ...string) (string, bool) {
+	return negotiate(w, req, "Accept", offers, BestContentType)
+}
+
+// Language is ContentType for Accept-Language.
+func Language(w *response.Writer, req *request.Request, offers ...string) (string, bool) {
+	return negotiate(w, req, "Accept-Language", offers, BestLanguage)
+}
+
+// Charset is ContentType for Accept-Charset.
+func Charset(w *response.Writer, req *request.Request, offers ...string) (string, bool) {
+	return negotiate(w, req, "Accept-Charset", offers, BestCharset)
+}
+
+func negotiate(w *response.Writer, req *request.Request, field string, offers []string, pick func(string, []string) string) (string, bool) {
+	w.AddFilter(func(_ response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+		headers.AddVary(h, field)
+		return nil
+	})
+
+	accept, _ := req.Headers.Get(field)
+	choice := pick(accept, offers)
+	if choice == "" {
+		body := "None of the available representations match " + field + ":\n" + strings.Join(offers, "\n") + "\n"
+		w.WriteResponse(response.StatusNotAcceptable, nil, []byte(body))
+		return "", false
+	}
+	return choice, true
+}
@@ -0,0 +1,88 @@
+package negotiate
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var offers = []string{"text/html", "application/json", "text/plain"}
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/html;level=1, application/json;q=0.5, */*;q=bogus,, text/plain;q=2`)
+	require.Len(t, ranges, 4)
+	assert.Equal(t, Range{Value: "text/html", Params: map[string]string{"level": "1"}, Q: 1}, ranges[0])
+	assert.Equal(t, 0.5, ranges[1].Q)
+	assert.Equal(t, 0.0, ranges[2].Q)
+	assert.Equal(t, 0.0, ranges[3].Q)
+}
+
+func TestBestContentType(t *testing.T) {
+	assert.Equal(t, "text/html", BestContentType("", offers))
+	assert.Equal(t, "application/json", BestContentType("application/json", offers))
+	assert.Equal(t, "text/html", BestContentType("text/*", offers))
+	assert.Equal(t, "text/plain", BestContentType("text/*;q=0.5, text/plain", offers))
+	assert.Equal(t, "application/json", BestContentType("text/*;q=0.5, */*", offers))
+	// the more specific range decides, even when it has a lower q-value
+	assert.Equal(t, "text/plain", BestContentType("text/html;q=0, */*;q=0.8", []string{"text/html", "text/plain"}))
+	assert.Equal(t, "", BestContentType("image/png", offers))
+	assert.Equal(t, "", BestContentType("*/*;q=0", offers))
+	// ranges with parameters only match offers carrying them
+	assert.Equal(t, "text/html; level=1", BestContentType("text/html;level=1, text/html;q=0.1",
+		[]string{"text/html", "text/html; level=1"}))
+	// browsers' typical header
+	assert.Equal(t, "text/html", BestContentType("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", offers))
+}
+
+func TestBestLanguage(t *testing.T) {
+	langs := []string{"en-US", "fr", "de-CH"}
+	assert.Equal(t, "fr", BestLanguage("fr-CA, fr;q=0.9, en;q=0.5", langs))
+	assert.Equal(t, "en-US", BestLanguage("EN", langs))
+	assert.Equal(t, "de-CH", BestLanguage("de, en;q=0.1", langs))
+	assert.Equal(t, "fr", BestLanguage("en-US;q=0, *", langs))
+	assert.Equal(t, "", BestLanguage("ja", langs))
+}
+
+func TestBestCharset(t *testing.T) {
+	charsets := []string{"utf-8", "iso-8859-1"}
+	assert.Equal(t, "utf-8", BestCharset("UTF-8", charsets))
+	assert.Equal(t, "iso-8859-1", BestCharset("utf-8;q=0.2, iso-8859-1", charsets))
+	assert.Equal(t, "utf-8", BestCharset("*", charsets))
+	assert.Equal(t, "", BestCharset("utf-16", charsets))
+}
+
+func TestContentType(t *testing.T) {
+	serve := func(accept string) *http.Response {
+		req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nAccept: " + accept + "\r\n\r\n"))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		w := &response.Writer{W: &buf}
+		if choice, ok := ContentType(w, req, offers...); ok {
+			h := response.GetDefaultHeaders(0)
+			h.Set("Content-Type", choice)
+			h.Set("Vary", "Origin")
+			w.WriteResponse(response.StatusOk, h, []byte("hi"))
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// Test: Chosen type with Vary appended
+	resp := serve("application/json")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Origin, Accept", resp.Header.Get("Vary"))
+
+	// Test: 406 when nothing fits
+	resp = serve("image/png")
+	assert.Equal(t, 406, resp.StatusCode)
+	assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+}
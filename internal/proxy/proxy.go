@@ -0,0 +1,387 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/client"
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/tracing"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	copyBufferSize = 32 * 1024
+)
+
+// hopByHop headers describe a single connection and are never forwarded.
+var hopByHop = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// redirects are relayed to the client, which follows them through the proxy
+var defaultClient = &client.Client{
+	MaxRedirects: -1,
+	Transport: &client.Transport{
+		DialTimeout:         10 * time.Second,
+		MaxIdleConnsPerHost: 16,
+	},
+}
+
+// Proxy forwards requests to an upstream server and relays its responses.
+type Proxy struct {
+	// Target is the upstream base URL. Its path is prepended to the forwarded path.
+	Target *url.URL
+	// StripPrefix is removed from the request path before it is forwarded.
+	StripPrefix string
+	// Timeout bounds the wait for the upstream response headers. Defaults to 30s.
+	Timeout time.Duration
+	// PreserveHost forwards the client's Host header instead of the target's.
+	PreserveHost bool
+	// Client performs the upstream requests. It should not follow redirects. Defaults to one that doesn't.
+	Client *client.Client
+	// Proto is the scheme clients used to reach the proxy, passed upstream in X-Forwarded-Proto and Forwarded.
+	// Defaults to "http"; set it to "https" when TLS is terminated in front of the server.
+	Proto string
+}
+
+func New(target string) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy target: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy target: %q", target)
+	}
+	return &Proxy{Target: u}, nil
+}
+
+// Handle forwards req upstream and streams the response back: status, headers, body and trailers.
+// It answers 504 when the upstream doesn't respond within Timeout and 502 on any other upstream failure.
+func (p *Proxy) Handle(w *response.Writer, req *request.Request) {
+	outURL := p.outgoingURL(req)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+
+	outReq, err := client.NewRequestWithContext(ctx, req.RequestLine.Method, outURL.String(), req.Body)
+	if err != nil {
+		timer.Stop()
+		w.Logger().Warn("failed to build upstream request", "url", outURL.String(), "error", err)
+		writeError(w, response.StatusBadGateway)
+		return
+	}
+	p.copyRequestHeaders(outReq, req)
+
+	span := tracing.SpanFromRequest(req)
+	if span != nil {
+		span = span.StartChild(req.RequestLine.Method, tracing.KindClient)
+		span.SetAttribute("http.request.method", req.RequestLine.Method)
+		span.SetAttribute("url.full", outURL.String())
+		span.Inject(outReq.Headers)
+		defer span.Finish()
+	}
+
+	c := p.Client
+	if c == nil {
+		c = defaultClient
+	}
+	resp, err := c.Do(outReq)
+	timer.Stop()
+	if err != nil {
+		if span != nil {
+			span.SetError(err.Error())
+		}
+		if req.Context().Err() != nil {
+			// our own client is gone, nobody to answer
+			return
+		}
+		w.Logger().Warn("upstream request failed", "url", outURL.String(), "error", err)
+		if timedOut.Load() || isTimeout(err) {
+			writeError(w, response.StatusGatewayTimeout)
+			return
+		}
+		writeError(w, response.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if span != nil {
+		span.SetAttribute("http.response.status_code", int(resp.StatusCode))
+	}
+
+	err = p.relay(w, req, resp)
+	if err != nil {
+		w.Logger().Warn("failed to relay upstream response", "url", outURL.String(), "error", err)
+	}
+}
+
+// outgoingURL joins the target path with the request path minus StripPrefix, and merges the queries.
+func (p *Proxy) outgoingURL(req *request.Request) *url.URL {
+	path := strings.TrimPrefix(req.Path(), p.StripPrefix)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u := *p.Target
+	u.Path = ""
+	u.RawPath = ""
+
+	base := strings.TrimSuffix(p.Target.EscapedPath(), "/")
+	out, err := url.Parse(u.String() + base + path)
+	if err != nil {
+		out = &u
+	}
+
+	query := req.RawQuery()
+	switch {
+	case p.Target.RawQuery == "":
+		out.RawQuery = query
+	case query == "":
+		out.RawQuery = p.Target.RawQuery
+	default:
+		out.RawQuery = p.Target.RawQuery + "&" + query
+	}
+	return out
+}
+
+func (p *Proxy) copyRequestHeaders(outReq *client.Request, req *request.Request) {
+	drop := connectionHeaders(req.Headers)
+	for k, v := range req.Headers {
+		if drop[k] || k == "host" || k == "content-length" {
+			continue
+		}
+		outReq.Headers[k] = v
+	}
+	// "TE: trailers" is the one hop-by-hop value worth passing on, it asks the upstream for trailers
+	if te, ok := req.Headers.Get("TE"); ok && hasToken(te, "trailers") {
+		outReq.Headers.Set("TE", "trailers")
+	}
+
+	host, _ := req.Headers.Get("Host")
+	if p.PreserveHost && host != "" {
+		outReq.Headers.Set("Host", host)
+	}
+
+	clientIP := ""
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		clientIP = ip
+	}
+	if clientIP != "" {
+		if prior, ok := req.Headers.Get("X-Forwarded-For"); ok && prior != "" {
+			outReq.Headers.Set("X-Forwarded-For", prior+", "+clientIP)
+		} else {
+			outReq.Headers.Set("X-Forwarded-For", clientIP)
+		}
+	}
+	if host != "" {
+		outReq.Headers.Set("X-Forwarded-Host", host)
+	}
+	proto := p.Proto
+	if proto == "" {
+		proto = "http"
+	}
+	outReq.Headers.Set("X-Forwarded-Proto", proto)
+
+	forwarded := forwardedElement(clientIP, host, proto)
+	if prior, ok := req.Headers.Get("Forwarded"); ok && prior != "" {
+		forwarded = prior + ", " + forwarded
+	}
+	outReq.Headers.Set("Forwarded", forwarded)
+
+	if id := req.RequestID(); id != "" && !hasHeader(outReq.Headers, "X-Request-ID") {
+		outReq.Headers.Set("X-Request-ID", id)
+	}
+}
+
+// forwardedElement builds this hop's RFC 7239 Forwarded element.
+func forwardedElement(clientIP, host, proto string) string {
+	var parts []string
+	if clientIP != "" {
+		node := clientIP
+		if strings.Contains(clientIP, ":") {
+			node = `"[` + clientIP + `]"`
+		}
+		parts = append(parts, "for="+node)
+	}
+	if host != "" {
+		parts = append(parts, "host="+headers.Quote(host))
+	}
+	parts = append(parts, "proto="+proto)
+	return strings.Join(parts, ";")
+}
+
+// relay writes the upstream response to w. Bodies of known length keep their Content-Length,
+// everything else is sent chunked with the upstream trailers at the end.
+func (p *Proxy) relay(w *response.Writer, req *request.Request, resp *client.Response) error {
+	h := headers.NewHeaders()
+	drop := connectionHeaders(resp.Headers)
+	for k, v := range resp.Headers {
+		if !drop[k] {
+			h[k] = v
+		}
+	}
+	for _, c := range resp.SetCookies {
+		err := w.SetRawCookie(c)
+		if err != nil {
+			w.Logger().Warn("dropping upstream cookie", "error", err)
+		}
+	}
+	if loc, ok := h.Get("Location"); ok {
+		h.Set("Location", p.rewriteLocation(loc))
+	}
+	h.Set("Connection", "close")
+
+	status := resp.StatusCode
+	var announced []string
+	if names, ok := resp.Headers.Get("Trailer"); ok {
+		for _, name := range headers.SplitList(names) {
+			if !drop[strings.ToLower(name)] {
+				announced = append(announced, name)
+			}
+		}
+	}
+	trailerNames := strings.Join(announced, ", ")
+	noBody := req.RequestLine.Method == "HEAD" || status == response.StatusNoContent ||
+		status == response.StatusNotModified || status < 200
+	chunked := !noBody && (resp.ContentLength < 0 || trailerNames != "")
+	if chunked {
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		if trailerNames != "" {
+			h.Set("Trailer", trailerNames)
+		}
+	} else if !noBody {
+		h.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+
+	err := w.WriteStatusLine(status)
+	if err != nil {
+		return err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+	if noBody {
+		return nil
+	}
+
+	buf := make([]byte, copyBufferSize)
+	_, err = io.CopyBuffer(bodyWriter{w}, resp.Body, buf)
+	if err != nil {
+		return fmt.Errorf("failed to copy body: %v", err)
+	}
+	if !chunked {
+		return nil
+	}
+
+	_, err = w.WriteChunkedBodyDone()
+	if err != nil {
+		return err
+	}
+	trailers := headers.NewHeaders()
+	for k, v := range resp.Trailers {
+		if !drop[k] {
+			trailers[k] = v
+		}
+	}
+	return w.WriteHeaders(trailers)
+}
+
+// rewriteLocation maps a redirect pointing into the target back onto the path the client used.
+func (p *Proxy) rewriteLocation(loc string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if u.IsAbs() && (u.Scheme != p.Target.Scheme || u.Host != p.Target.Host) {
+		return loc
+	}
+	if !u.IsAbs() && !strings.HasPrefix(u.Path, "/") {
+		return loc
+	}
+
+	base := strings.TrimSuffix(p.Target.Path, "/")
+	if base != "" && u.Path != base && !strings.HasPrefix(u.Path, base+"/") {
+		return loc
+	}
+	path := p.StripPrefix + strings.TrimPrefix(u.Path, base)
+	if path == "" {
+		path = "/"
+	}
+	out := url.URL{Path: path, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	return out.String()
+}
+
+// connectionHeaders returns the lowercased hop-by-hop headers of h, including those named in Connection.
+func connectionHeaders(h headers.Headers) map[string]bool {
+	drop := map[string]bool{}
+	for _, name := range hopByHop {
+		drop[strings.ToLower(name)] = true
+	}
+	if conn, ok := h.Get("Connection"); ok {
+		for _, name := range headers.SplitList(conn) {
+			drop[strings.ToLower(name)] = true
+		}
+	}
+	return drop
+}
+
+func hasHeader(h headers.Headers, key string) bool {
+	_, ok := h.Get(key)
+	return ok
+}
+
+func hasToken(list, token string) bool {
+	for _, v := range headers.SplitList(list) {
+		if strings.EqualFold(v, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func writeError(w *response.Writer, code response.StatusCode) {
+	body := []byte(response.StatusText(code) + "\n")
+	w.WriteResponse(code, response.GetDefaultHeaders(0), body)
+}
+
+// bodyWriter hides the Writer's ReadFrom so every read from upstream is sent on right away.
+type bodyWriter struct {
+	w *response.Writer
+}
+
+func (bw bodyWriter) Write(p []byte) (int, error) {
+	return bw.w.WriteBody(p)
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run sends reqText through the proxy and parses what it wrote with net/http.
+func run(t *testing.T, p *Proxy, reqText string) (*http.Response, []byte) {
+	req, err := request.RequestFromReader(strings.NewReader(reqText))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:51234"
+
+	var buf bytes.Buffer
+	w := &response.Writer{W: &buf}
+	p.Handle(w, req)
+	require.NoError(t, w.Close())
+
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func newProxy(t *testing.T, target string) *Proxy {
+	p, err := New(target)
+	require.NoError(t, err)
+	return p
+}
+
+func TestForwardsRequest(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	p := newProxy(t, upstream.URL+"/api")
+	p.StripPrefix = "/proxy"
+	resp, body := run(t, p, "POST /proxy/items?x=1 HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"Connection: keep-alive, X-Secret\r\n"+
+		"X-Secret: hop\r\n"+
+		"Proxy-Authorization: Basic Zm9vOmJhcg==\r\n"+
+		"X-Forwarded-For: 198.51.100.1\r\n"+
+		"\r\n"+
+		"hello")
+
+	// Test: method, path, query, body and end-to-end headers reach the upstream
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/api/items", got.URL.Path)
+	assert.Equal(t, "x=1", got.URL.RawQuery)
+	assert.Equal(t, "hello", string(gotBody))
+	assert.Equal(t, "text/plain", got.Header.Get("Content-Type"))
+	assert.Equal(t, strings.TrimPrefix(upstream.URL, "http://"), got.Host)
+
+	// Test: hop-by-hop headers are stripped, including those named in Connection
+	assert.Empty(t, got.Header.Get("X-Secret"))
+	assert.Empty(t, got.Header.Get("Proxy-Authorization"))
+
+	// Test: forwarding headers
+	assert.Equal(t, "198.51.100.1, 192.0.2.7", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=192.0.2.7;host=example.com;proto=http", got.Header.Get("Forwarded"))
+
+	// Test: the upstream response is relayed without its hop-by-hop headers
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "created", string(body))
+	assert.Empty(t, resp.Header.Get("Keep-Alive"))
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.Header.Values("Set-Cookie"))
+
+	// Test: the forwarded proto can be set for a server behind a TLS terminator
+	p.Proto = "https"
+	run(t, p, "GET /proxy/items HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	assert.Equal(t, "https", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=192.0.2.7;host=example.com;proto=https", got.Header.Get("Forwarded"))
+}
+
+func TestStreamsTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("part one, "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("part two"))
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+	defer upstream.Close()
+
+	resp, body := run(t, newProxy(t, upstream.URL), "GET /stream HTTP/1.1\r\nHost: localhost\r\nTE: trailers\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Equal(t, "part one, part two", string(body))
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"))
+}
+
+func TestDropsHopByHopTrailers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		http.ReadRequest(bufio.NewReader(conn))
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n" +
+			"Connection: X-Hop\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum, X-Hop, Keep-Alive\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"X-Hop: secret\r\n" +
+			"Keep-Alive: timeout=5\r\n" +
+			"\r\n"))
+	}()
+
+	// Test: trailers named in Connection or hop-by-hop are neither announced nor relayed
+	resp, body := run(t, newProxy(t, "http://"+l.Addr().String()), "GET / HTTP/1.1\r\nHost: localhost\r\nTE: trailers\r\n\r\n")
+	assert.Equal(t, "abc", string(body))
+	assert.Equal(t, "abc123", resp.Trailer.Get("X-Checksum"))
+	assert.NotContains(t, resp.Trailer, "X-Hop")
+	assert.NotContains(t, resp.Trailer, "Keep-Alive")
+}
+
+func TestRewritesLocation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/absolute":
+			http.Redirect(w, r, "http://"+r.Host+"/api/next?page=2", http.StatusFound)
+		case "/api/relative":
+			http.Redirect(w, r, "/api/next", http.StatusFound)
+		default:
+			http.Redirect(w, r, "https://elsewhere.example/", http.StatusFound)
+		}
+	}))
+	defer upstream.Close()
+
+	p := newProxy(t, upstream.URL+"/api/")
+	p.StripPrefix = "/proxy"
+
+	// Test: absolute URL on the upstream
+	resp, _ := run(t, p, "GET /proxy/absolute HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/proxy/next?page=2", resp.Header.Get("Location"))
+
+	// Test: absolute path on the upstream
+	resp, _ = run(t, p, "GET /proxy/relative HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "/proxy/next", resp.Header.Get("Location"))
+
+	// Test: other hosts are left alone
+	resp, _ = run(t, p, "GET /proxy/other HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "https://elsewhere.example/", resp.Header.Get("Location"))
+}
+
+func TestHead(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer upstream.Close()
+
+	resp, body := run(t, newProxy(t, upstream.URL), "HEAD / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(42), resp.ContentLength)
+	assert.Empty(t, body)
+}
+
+func TestUpstreamFailures(t *testing.T) {
+	// Test: connection refused is a 502
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	resp, _ := run(t, newProxy(t, "http://"+addr), "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	// Test: a slow upstream is a 504
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p := newProxy(t, upstream.URL)
+	p.Timeout = 50 * time.Millisecond
+	resp, _ = run(t, p, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("localhost:8080")
+	assert.Error(t, err)
+	_, err = New("ftp://example.com")
+	assert.Error(t, err)
+	_, err = New("http://example.com/base")
+	assert.NoError(t, err)
+}
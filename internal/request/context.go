@@ -0,0 +1,50 @@
+package request
+
+import "context"
+
+// Context returns the request's context. The server cancels it when the client goes away,
+// the server shuts down or the request deadline passes.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r with its context replaced by ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("request: nil context")
+	}
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	paramsKey
+)
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID stored in the request's context, or "".
+func (r *Request) RequestID() string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// ContextWithParams stores route parameters, such as the "id" in "/users/{id}", for the handler.
+func ContextWithParams(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, paramsKey, params)
+}
+
+// Param returns a route parameter stored in the request's context, or "".
+func (r *Request) Param(name string) string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
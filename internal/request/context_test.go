@@ -0,0 +1,36 @@
+package request
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET /users/42 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+
+	// Test: Background by default
+	assert.Equal(t, context.Background(), r.Context())
+	assert.Equal(t, "", r.RequestID())
+	assert.Equal(t, "", r.Param("id"))
+
+	// Test: WithContext copies the request and carries values
+	ctx, cancel := context.WithCancel(ContextWithRequestID(context.Background(), "req-1"))
+	ctx = ContextWithParams(ctx, map[string]string{"id": "42"})
+	r2 := r.WithContext(ctx)
+	assert.NotSame(t, r, r2)
+	assert.Equal(t, context.Background(), r.Context())
+	assert.Equal(t, "req-1", r2.RequestID())
+	assert.Equal(t, "42", r2.Param("id"))
+	assert.Equal(t, r.RequestLine, r2.RequestLine)
+
+	cancel()
+	assert.ErrorIs(t, r2.Context().Err(), context.Canceled)
+}
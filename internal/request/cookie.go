@@ -0,0 +1,17 @@
+package request
+
+import "github.com/lordvorath/httpfromtcp/internal/headers"
+
+// Cookies returns the cookies sent in the Cookie header, keyed by name.
+func (r *Request) Cookies() map[string]string {
+	value, ok := r.Headers.Get("Cookie")
+	if !ok {
+		return map[string]string{}
+	}
+	return headers.ParseCookies(value)
+}
+
+func (r *Request) Cookie(name string) (string, bool) {
+	value, ok := r.Cookies()[name]
+	return value, ok
+}
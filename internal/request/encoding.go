@@ -0,0 +1,85 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrBodyTooLarge        = errors.New("decoded body too large")
+)
+
+// DecodeBody undoes the body's Content-Encoding (gzip, deflate or identity, possibly stacked) in place.
+// Decoding stops with ErrBodyTooLarge once the output would exceed maxSize bytes, so a small body that inflates
+// to a huge one is never held in memory. maxSize does not bound the encoded body: the parser has already
+// buffered it whole by the time DecodeBody runs.
+// On success Content-Encoding is removed and Content-Length describes the decoded body.
+func (r *Request) DecodeBody(maxSize int64) error {
+	value, ok := r.Headers.Get("Content-Encoding")
+	if !ok {
+		return nil
+	}
+
+	var codings []string
+	for _, c := range strings.Split(value, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		switch c {
+		case "", "identity":
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, c)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, c)
+		}
+	}
+
+	body := r.Body
+	// codings are listed in the order they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoded, err := decode(codings[i], body, maxSize)
+		if err != nil {
+			return err
+		}
+		body = decoded
+	}
+
+	r.Body = body
+	r.Headers.Del("Content-Encoding")
+	r.Headers.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func decode(coding string, data []byte, maxSize int64) ([]byte, error) {
+	var rc io.ReadCloser
+	var err error
+	switch coding {
+	case "gzip", "x-gzip":
+		rc, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		// "deflate" should be zlib-wrapped, but some clients send raw deflate data
+		rc, err = zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			rc, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s body: %v", coding, err)
+	}
+	defer rc.Close()
+
+	out, err := io.ReadAll(io.LimitReader(rc, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s body: %v", coding, err)
+	}
+	if int64(len(out)) > maxSize {
+		return nil, ErrBodyTooLarge
+	}
+	return out, nil
+}
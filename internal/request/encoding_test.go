@@ -0,0 +1,98 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodedRequest(t *testing.T, encoding string, body []byte) *Request {
+	reader := &chunkReader{
+		data: "POST /telemetry HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Encoding: " + encoding + "\r\n" +
+			"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+			"\r\n" + string(body),
+		numBytesPerRead: 7,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	return r
+}
+
+func TestDecodeBody(t *testing.T) {
+	payload := strings.Repeat(`{"cpu": 0.5}`, 50)
+
+	// Test: gzip body
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write([]byte(payload))
+	gw.Close()
+	r := encodedRequest(t, "gzip", buf.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, string(r.Body))
+	_, ok := r.Headers.Get("Content-Encoding")
+	assert.False(t, ok)
+	assert.Equal(t, strconv.Itoa(len(payload)), r.Headers["content-length"])
+
+	// Test: zlib-wrapped deflate body
+	buf.Reset()
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(payload))
+	zw.Close()
+	r = encodedRequest(t, "deflate", buf.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, string(r.Body))
+
+	// Test: raw deflate body
+	buf.Reset()
+	fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	fw.Write([]byte(payload))
+	fw.Close()
+	r = encodedRequest(t, "deflate", buf.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, string(r.Body))
+
+	// Test: Stacked codings are undone in reverse order
+	buf.Reset()
+	zw = zlib.NewWriter(&buf)
+	zw.Write([]byte(payload))
+	zw.Close()
+	var outer bytes.Buffer
+	gw = gzip.NewWriter(&outer)
+	gw.Write(buf.Bytes())
+	gw.Close()
+	r = encodedRequest(t, "deflate, gzip", outer.Bytes())
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, payload, string(r.Body))
+
+	// Test: Decompression bomb is stopped at the limit
+	buf.Reset()
+	gw = gzip.NewWriter(&buf)
+	gw.Write(make([]byte, 1<<20))
+	gw.Close()
+	r = encodedRequest(t, "gzip", buf.Bytes())
+	assert.ErrorIs(t, r.DecodeBody(1024), ErrBodyTooLarge)
+
+	// Test: Unknown coding
+	r = encodedRequest(t, "br", []byte("whatever"))
+	assert.ErrorIs(t, r.DecodeBody(1<<20), ErrUnsupportedEncoding)
+
+	// Test: Corrupt body
+	r = encodedRequest(t, "gzip", []byte("not gzip"))
+	err := r.DecodeBody(1 << 20)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedEncoding)
+
+	// Test: Identity and no encoding are left untouched
+	r = encodedRequest(t, "identity", []byte("plain"))
+	require.NoError(t, r.DecodeBody(1<<20))
+	assert.Equal(t, "plain", string(r.Body))
+}
@@ -0,0 +1,112 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+var (
+	ErrNotForm         = errors.New("request body is not application/x-www-form-urlencoded")
+	ErrTooManyKeys     = errors.New("too many keys")
+	ErrFormTooLarge    = errors.New("form data too large")
+	errInvalidEncoding = errors.New("invalid percent-encoding")
+)
+
+type Limits struct {
+	// MaxKeys is the maximum number of key/value pairs.
+	MaxKeys int
+	// MaxSize is the maximum size in bytes of the encoded data.
+	MaxSize int
+}
+
+var DefaultLimits = Limits{
+	MaxKeys: 1000,
+	MaxSize: 1 << 20,
+}
+
+// Values maps a key to all of its values, in the order they appeared.
+type Values map[string][]string
+
+func (v Values) Get(key string) string {
+	vals := v[key]
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+func (v Values) Add(key, val string) {
+	v[key] = append(v[key], val)
+}
+
+func (v Values) Set(key, val string) {
+	v[key] = []string{val}
+}
+
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// Path returns the request target without its query string.
+func (r *Request) Path() string {
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// RawQuery returns the part of the request target after '?', still encoded.
+func (r *Request) RawQuery() string {
+	_, query, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return query
+}
+
+// Query parses the query string of the request target using DefaultLimits.
+func (r *Request) Query() (Values, error) {
+	return ParseQuery(r.RawQuery(), DefaultLimits)
+}
+
+// Form parses an application/x-www-form-urlencoded body using DefaultLimits.
+func (r *Request) Form() (Values, error) {
+	contentType, _ := r.Headers.Get("Content-Type")
+	mediaType, err := headers.ParseMediaType(contentType)
+	if err != nil || mediaType.Essence() != "application/x-www-form-urlencoded" {
+		return nil, ErrNotForm
+	}
+	return ParseQuery(string(r.Body), DefaultLimits)
+}
+
+// ParseQuery decodes "a=1&b=2&a=3" style data, where '+' stands for a space and %XX for an encoded byte.
+// Repeated keys keep all of their values. A key without '=' gets an empty value.
+func ParseQuery(s string, limits Limits) (Values, error) {
+	if limits.MaxSize > 0 && len(s) > limits.MaxSize {
+		return nil, ErrFormTooLarge
+	}
+
+	values := Values{}
+	keys := 0
+	for pair := range strings.SplitSeq(s, "&") {
+		if pair == "" {
+			continue
+		}
+		keys++
+		if limits.MaxKeys > 0 && keys > limits.MaxKeys {
+			return nil, ErrTooManyKeys
+		}
+
+		rawKey, rawVal, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w in key %q", errInvalidEncoding, rawKey)
+		}
+		val, err := url.QueryUnescape(rawVal)
+		if err != nil {
+			return nil, fmt.Errorf("%w in value %q", errInvalidEncoding, rawVal)
+		}
+		values.Add(key, val)
+	}
+	return values, nil
+}
@@ -0,0 +1,95 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	// Test: Simple query with repeated keys
+	reader := &chunkReader{
+		data:            "GET /search?q=go+lang&tag=a&tag=b%26c&empty=&flag HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/search", r.Path())
+	q, err := r.Query()
+	require.NoError(t, err)
+	assert.Equal(t, "go lang", q.Get("q"))
+	assert.Equal(t, []string{"a", "b&c"}, q["tag"])
+	assert.True(t, q.Has("empty"))
+	assert.Equal(t, "", q.Get("empty"))
+	assert.True(t, q.Has("flag"))
+	assert.False(t, q.Has("missing"))
+
+	// Test: No query string
+	reader = &chunkReader{
+		data:            "GET /plain HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/plain", r.Path())
+	q, err = r.Query()
+	require.NoError(t, err)
+	assert.Empty(t, q)
+
+	// Test: Percent-decoding of multi-byte characters and literal plus
+	q, err = ParseQuery("name=%C3%A9t%C3%A9&sum=1%2B1", DefaultLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "été", q.Get("name"))
+	assert.Equal(t, "1+1", q.Get("sum"))
+
+	// Test: Invalid percent-encoding
+	_, err = ParseQuery("a=%zz", DefaultLimits)
+	require.Error(t, err)
+	_, err = ParseQuery("a=%4", DefaultLimits)
+	require.Error(t, err)
+
+	// Test: Key count limit
+	_, err = ParseQuery("a=1&b=2&c=3", Limits{MaxKeys: 2})
+	assert.ErrorIs(t, err, ErrTooManyKeys)
+
+	// Test: Size limit
+	_, err = ParseQuery(strings.Repeat("a", 100), Limits{MaxSize: 10})
+	assert.ErrorIs(t, err, ErrFormTooLarge)
+}
+
+func TestForm(t *testing.T) {
+	// Test: urlencoded body
+	body := "user=jane+doe&lang=go&lang=rust&note=100%25"
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Type: application/x-www-form-urlencoded; charset=utf-8\r\n" +
+			"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+			"\r\n" + body,
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	form, err := r.Form()
+	require.NoError(t, err)
+	assert.Equal(t, "jane doe", form.Get("user"))
+	assert.Equal(t, []string{"go", "rust"}, form["lang"])
+	assert.Equal(t, "100%", form.Get("note"))
+
+	// Test: Wrong content type
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Type: application/json\r\n" +
+			"Content-Length: 2\r\n" +
+			"\r\n{}",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.Form()
+	assert.ErrorIs(t, err, ErrNotForm)
+}
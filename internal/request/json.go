@@ -0,0 +1,55 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+const DefaultMaxJSONSize = 1 << 20
+
+var (
+	ErrNotJSON      = errors.New("request body is not application/json")
+	ErrJSONTooLarge = errors.New("JSON body too large")
+)
+
+// DecodeJSON decodes the body into v. The Content-Type must be application/json or a +json type in UTF-8,
+// the body at most maxSize bytes, and it must hold exactly one JSON value with no fields unknown to v.
+// The body has already been read whole by the parser, so maxSize only bounds what is handed to the
+// JSON decoder, not what the server reads from the connection.
+func (r *Request) DecodeJSON(v any, maxSize int64) error {
+	contentType, _ := r.Headers.Get("Content-Type")
+	mediaType, err := headers.ParseMediaType(contentType)
+	if err != nil {
+		return ErrNotJSON
+	}
+	if mediaType.Essence() != "application/json" && !(mediaType.Type == "application" && strings.HasSuffix(mediaType.Subtype, "+json")) {
+		return ErrNotJSON
+	}
+	if charset, ok := mediaType.Params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return ErrNotJSON
+	}
+	if int64(len(r.Body)) > maxSize {
+		return ErrJSONTooLarge
+	}
+	if len(bytes.TrimSpace(r.Body)) == 0 {
+		return errors.New("request body is empty")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.Body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	_, err = dec.Token()
+	if !errors.Is(err, io.EOF) {
+		return errors.New("invalid JSON body: unexpected data after the top-level value")
+	}
+	return nil
+}
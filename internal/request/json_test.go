@@ -0,0 +1,57 @@
+package request
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonRequest(t *testing.T, contentType, body string) *Request {
+	reader := &chunkReader{
+		data: "POST /api HTTP/1.1\r\nHost: localhost:42069\r\nContent-Type: " + contentType +
+			"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body,
+		numBytesPerRead: 6,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	return r
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	// Test: Valid body
+	var v item
+	r := jsonRequest(t, "application/json; charset=UTF-8", `{"name":"widget","count":3}`)
+	require.NoError(t, r.DecodeJSON(&v, DefaultMaxJSONSize))
+	assert.Equal(t, item{Name: "widget", Count: 3}, v)
+
+	// Test: +json media types are accepted
+	r = jsonRequest(t, "application/merge-patch+json", `{"count":4}`)
+	require.NoError(t, r.DecodeJSON(&v, DefaultMaxJSONSize))
+	assert.Equal(t, 4, v.Count)
+
+	// Test: Wrong Content-Type or charset
+	r = jsonRequest(t, "text/plain", `{}`)
+	assert.ErrorIs(t, r.DecodeJSON(&v, DefaultMaxJSONSize), ErrNotJSON)
+	r = jsonRequest(t, "application/json; charset=latin1", `{}`)
+	assert.ErrorIs(t, r.DecodeJSON(&v, DefaultMaxJSONSize), ErrNotJSON)
+
+	// Test: Size limit
+	r = jsonRequest(t, "application/json", `{"name":"this is too long"}`)
+	assert.ErrorIs(t, r.DecodeJSON(&v, 10), ErrJSONTooLarge)
+
+	// Test: Unknown fields, trailing data, syntax errors and empty bodies
+	for _, body := range []string{`{"name":"a","extra":1}`, `{"name":"a"} {}`, `{"name":`, `{"count":"x"}`, " "} {
+		r = jsonRequest(t, "application/json", body)
+		err := r.DecodeJSON(&v, DefaultMaxJSONSize)
+		assert.Error(t, err, body)
+		assert.NotErrorIs(t, err, ErrNotJSON)
+		assert.NotErrorIs(t, err, ErrJSONTooLarge)
+	}
+}
@@ -0,0 +1,337 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+const (
+	multipartBufferSize = 64 * 1024
+	maxPartHeaderBytes  = 16 * 1024
+)
+
+var (
+	ErrNotMultipart      = errors.New("request body is not multipart/form-data")
+	ErrMultipartTooLarge = errors.New("multipart data too large")
+	errMissingBoundary   = errors.New("missing or invalid multipart boundary")
+)
+
+// MultipartLimits bound what ReadForm accepts. Zero means unlimited.
+type MultipartLimits struct {
+	// MaxFieldSize caps the combined size of all non-file values.
+	MaxFieldSize int64
+	// MaxFileSize caps the size of a single file.
+	MaxFileSize int64
+	// MaxParts caps the number of parts.
+	MaxParts int
+}
+
+var DefaultMultipartLimits = MultipartLimits{
+	MaxFieldSize: 1 << 20,
+	MaxParts:     1000,
+}
+
+// MultipartReader iterates over the parts of a multipart body, parsing them from the underlying reader
+// as they are read.
+type MultipartReader struct {
+	br       *bufio.Reader
+	delim    []byte // "\r\n--boundary"
+	dashBdry []byte // "--boundary"
+	current  *Part
+	started  bool
+	finished bool
+}
+
+type Part struct {
+	Headers headers.Headers
+
+	mr  *MultipartReader
+	eof bool
+}
+
+func NewMultipartReader(r io.Reader, boundary string) *MultipartReader {
+	return &MultipartReader{
+		br:       bufio.NewReaderSize(r, multipartBufferSize),
+		delim:    []byte("\r\n--" + boundary),
+		dashBdry: []byte("--" + boundary),
+	}
+}
+
+// MultipartReader returns a reader over the request body using the boundary from its Content-Type.
+// The body has been read in full by the time the request is parsed, so this saves parsing, not memory.
+func (r *Request) MultipartReader() (*MultipartReader, error) {
+	contentType, _ := r.Headers.Get("Content-Type")
+	mediaType, err := headers.ParseMediaType(contentType)
+	if err != nil || mediaType.Essence() != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := mediaType.Params["boundary"]
+	if boundary == "" || len(boundary) > 70 {
+		return nil, errMissingBoundary
+	}
+	return NewMultipartReader(bytes.NewReader(r.Body), boundary), nil
+}
+
+// NextPart skips whatever is left of the current part and returns the next one, or io.EOF after the last.
+func (mr *MultipartReader) NextPart() (*Part, error) {
+	if mr.finished {
+		return nil, io.EOF
+	}
+
+	if mr.current != nil {
+		_, err := io.Copy(io.Discard, mr.current)
+		if err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+
+	if !mr.started {
+		err := mr.skipPreamble()
+		if err != nil {
+			return nil, err
+		}
+		mr.started = true
+	} else {
+		_, err := mr.br.Discard(len(mr.delim))
+		if err != nil {
+			return nil, fmt.Errorf("malformed multipart body: %v", err)
+		}
+		err = mr.readBoundaryLineEnd()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mr.finished {
+		return nil, io.EOF
+	}
+
+	h := headers.NewHeaders()
+	read := 0
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if err != nil {
+			return nil, fmt.Errorf("malformed part headers: %v", err)
+		}
+		read += len(line)
+		if read > maxPartHeaderBytes {
+			return nil, fmt.Errorf("part headers too large")
+		}
+		_, done, err := h.Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	mr.current = &Part{Headers: h, mr: mr}
+	return mr.current, nil
+}
+
+// skipPreamble discards everything up to and including the first boundary line.
+func (mr *MultipartReader) skipPreamble() error {
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("multipart boundary not found: %v", err)
+		}
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		if bytes.Equal(trimmed, mr.dashBdry) {
+			return nil
+		}
+		if bytes.Equal(trimmed, append(mr.dashBdry, '-', '-')) {
+			mr.finished = true
+			return nil
+		}
+	}
+}
+
+// readBoundaryLineEnd consumes what follows a boundary: "--" for the final one, otherwise optional
+// whitespace and CRLF.
+func (mr *MultipartReader) readBoundaryLineEnd() error {
+	peek, err := mr.br.Peek(2)
+	if err == nil && string(peek) == "--" {
+		mr.finished = true
+		return nil
+	}
+	line, err := mr.br.ReadSlice('\n')
+	if err != nil {
+		return fmt.Errorf("malformed multipart boundary: %v", err)
+	}
+	if len(bytes.TrimRight(line, " \t\r\n")) != 0 {
+		return fmt.Errorf("malformed multipart boundary")
+	}
+	return nil
+}
+
+// Read reads the part body up to the next boundary.
+func (p *Part) Read(b []byte) (int, error) {
+	if p.eof {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	br := p.mr.br
+	delim := p.mr.delim
+	peek, err := br.Peek(max(br.Buffered(), len(delim)))
+	if idx := bytes.Index(peek, delim); idx >= 0 {
+		if idx == 0 {
+			p.eof = true
+			return 0, io.EOF
+		}
+		n := copy(b, peek[:idx])
+		br.Discard(n)
+		return n, nil
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	// the tail could be the start of a delimiter, keep it buffered
+	safe := len(peek) - len(delim) + 1
+	n := copy(b, peek[:safe])
+	br.Discard(n)
+	return n, nil
+}
+
+func (p *Part) FormName() string {
+	return p.dispositionParams()["name"]
+}
+
+// FileName returns the base name of the uploaded file, or "" if the part is not a file.
+func (p *Part) FileName() string {
+	name, ok := p.dispositionParams()["filename"]
+	if !ok {
+		return ""
+	}
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+func (p *Part) dispositionParams() map[string]string {
+	cd, _ := p.Headers.Get("Content-Disposition")
+	_, params, err := headers.ParseParams(cd)
+	if err != nil {
+		return nil
+	}
+	return params
+}
+
+type MultipartForm struct {
+	Value Values
+	File  map[string][]*FileHeader
+}
+
+type FileHeader struct {
+	Filename string
+	Headers  headers.Headers
+	Size     int64
+
+	content []byte
+}
+
+// Open returns the file contents.
+func (fh *FileHeader) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(fh.content)), nil
+}
+
+// MultipartForm parses the whole multipart body into memory, values and files alike. The request body
+// is already buffered, so the limits bound the parsed form rather than what is read from the connection.
+func (r *Request) MultipartForm(limits MultipartLimits) (*MultipartForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	return mr.ReadForm(limits)
+}
+
+func (mr *MultipartReader) ReadForm(limits MultipartLimits) (*MultipartForm, error) {
+	form := &MultipartForm{
+		Value: Values{},
+		File:  map[string][]*FileHeader{},
+	}
+	fieldBudget := limits.MaxFieldSize
+
+	parts := 0
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts++
+		if limits.MaxParts > 0 && parts > limits.MaxParts {
+			return nil, ErrTooManyKeys
+		}
+
+		name := part.FormName()
+		filename := part.FileName()
+
+		if filename == "" {
+			var src io.Reader = part
+			if limits.MaxFieldSize > 0 {
+				src = io.LimitReader(part, fieldBudget+1)
+			}
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, src)
+			if err != nil {
+				return nil, err
+			}
+			fieldBudget -= n
+			if limits.MaxFieldSize > 0 && fieldBudget < 0 {
+				return nil, ErrMultipartTooLarge
+			}
+			form.Value.Add(name, buf.String())
+			continue
+		}
+
+		fh, err := readFile(part, filename, limits.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		form.File[name] = append(form.File[name], fh)
+	}
+}
+
+func readFile(part *Part, filename string, maxFileSize int64) (*FileHeader, error) {
+	var src io.Reader = part
+	if maxFileSize > 0 {
+		src = io.LimitReader(part, maxFileSize+1)
+	}
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, src)
+	if err != nil {
+		return nil, err
+	}
+	if maxFileSize > 0 && n > maxFileSize {
+		return nil, ErrMultipartTooLarge
+	}
+	return &FileHeader{
+		Filename: filename,
+		Headers:  part.Headers,
+		Size:     n,
+		content:  buf.Bytes(),
+	}, nil
+}
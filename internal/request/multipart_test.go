@@ -0,0 +1,125 @@
+package request
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const multipartBody = "preamble\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n" +
+	"\r\n" +
+	"hello\r\nworld\r\n" +
+	"--xYzZY\r\n" +
+	"Content-Disposition: form-data; name=\"upload\"; filename=\"C:\\\\docs\\\\notes.txt\"\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"line one\r\n--not the boundary\r\n" +
+	"--xYzZY--\r\n" +
+	"epilogue"
+
+func multipartRequest(t *testing.T, contentType, body string) *Request {
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Type: " + contentType +
+			"\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body,
+		numBytesPerRead: 7,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	return r
+}
+
+func TestMultipartReader(t *testing.T) {
+	// Test: Parts are streamed with their own headers, even when reads split the boundary
+	for _, n := range []int{1, 3, 64} {
+		mr := NewMultipartReader(&chunkReader{data: multipartBody, numBytesPerRead: n}, "xYzZY")
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, "title", part.FormName())
+		assert.Equal(t, "", part.FileName())
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, "hello\r\nworld", string(data))
+
+		part, err = mr.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, "upload", part.FormName())
+		assert.Equal(t, "notes.txt", part.FileName())
+		contentType, _ := part.Headers.Get("Content-Type")
+		assert.Equal(t, "text/plain", contentType)
+		data, err = io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, "line one\r\n--not the boundary", string(data))
+
+		_, err = mr.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	// Test: Unread parts are skipped
+	mr := NewMultipartReader(&chunkReader{data: multipartBody, numBytesPerRead: 5}, "xYzZY")
+	_, err := mr.NextPart()
+	require.NoError(t, err)
+	part, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "upload", part.FormName())
+
+	// Test: Missing closing boundary
+	mr = NewMultipartReader(strings.NewReader("--b\r\n\r\nunterminated"), "b")
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	_, err = io.ReadAll(part)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Boundary comes from the Content-Type
+	r := multipartRequest(t, `multipart/form-data; boundary="xYzZY"`, multipartBody)
+	mr, err = r.MultipartReader()
+	require.NoError(t, err)
+	part, err = mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", part.FormName())
+
+	// Test: Wrong media type and missing boundary
+	r = multipartRequest(t, "text/plain", "x")
+	_, err = r.MultipartReader()
+	assert.ErrorIs(t, err, ErrNotMultipart)
+	r = multipartRequest(t, "multipart/form-data", "x")
+	_, err = r.MultipartReader()
+	assert.Error(t, err)
+}
+
+func TestMultipartForm(t *testing.T) {
+	// Test: Values and files
+	r := multipartRequest(t, "multipart/form-data; boundary=xYzZY", multipartBody)
+	form, err := r.MultipartForm(DefaultMultipartLimits)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\r\nworld", form.Value.Get("title"))
+	require.Len(t, form.File["upload"], 1)
+	fh := form.File["upload"][0]
+	assert.Equal(t, "notes.txt", fh.Filename)
+	assert.Equal(t, int64(28), fh.Size)
+	f, err := fh.Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "line one\r\n--not the boundary", string(data))
+
+	// Test: Limits
+	_, err = r.MultipartForm(MultipartLimits{MaxFieldSize: 4})
+	assert.ErrorIs(t, err, ErrMultipartTooLarge)
+	_, err = r.MultipartForm(MultipartLimits{MaxFieldSize: 1024, MaxFileSize: 20})
+	assert.ErrorIs(t, err, ErrMultipartTooLarge)
+	_, err = r.MultipartForm(MultipartLimits{MaxFieldSize: 1024, MaxParts: 1})
+	assert.ErrorIs(t, err, ErrTooManyKeys)
+
+	// Test: Zero limits are unlimited
+	form, err = r.MultipartForm(MultipartLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello\r\nworld", form.Value.Get("title"))
+	assert.Equal(t, int64(28), form.File["upload"][0].Size)
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -28,6 +29,11 @@ type Request struct {
 	Headers     headers.Headers
 	Body        []byte
 	ParserState requestState
+	// RemoteAddr is the client's address, set by the server.
+	RemoteAddr string
+
+	buffered []byte
+	ctx      context.Context
 }
 
 type RequestLine struct {
@@ -75,9 +81,19 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 		readToIndex -= n
 	}
 
+	if readToIndex > 0 {
+		req.buffered = make([]byte, readToIndex)
+		copy(req.buffered, buffer[:readToIndex])
+	}
+
 	return req, nil
 }
 
+// Buffered returns bytes that were read from the connection past the end of the request.
+func (r *Request) Buffered() []byte {
+	return r.buffered
+}
+
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte(crlf))
 	if idx == -1 {
@@ -159,19 +175,21 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		contentLength, ok := r.Headers.Get("Content-Length")
 		if !ok {
 			r.ParserState = requestStateDone
-			return len(data), nil
+			return 0, nil
 		}
 		cLInt, err := strconv.Atoi(contentLength)
 		if err != nil {
 			return 0, fmt.Errorf("invalid Content-Length")
 		}
-		r.Body = append(r.Body, data...)
-		if len(r.Body) > cLInt {
-			return 0, fmt.Errorf("mismatching Content-Length and Body length")
-		} else if len(r.Body) == cLInt {
+		if cLInt < 0 {
+			return 0, fmt.Errorf("invalid Content-Length")
+		}
+		n := min(cLInt-len(r.Body), len(data))
+		r.Body = append(r.Body, data[:n]...)
+		if len(r.Body) == cLInt {
 			r.ParserState = requestStateDone
 		}
-		return len(data), nil
+		return n, nil
 	case requestStateDone:
 		return 0, fmt.Errorf("error: trying to read data in a done state")
 	default:
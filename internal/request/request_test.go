@@ -261,3 +261,38 @@ func TestBodyParse(t *testing.T) {
 	require.NotNil(t, r)
 	assert.Equal(t, "", string(r.Body))
 }
+
+func TestBufferedBytes(t *testing.T) {
+	// Test: Bytes past the end of the request are kept
+	reader := &chunkReader{
+		data:            "GET /ws HTTP/1.1\r\nHost: localhost:42069\r\n\r\nextra bytes",
+		numBytesPerRead: 100,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "extra bytes", string(r.Buffered())+string(rest))
+
+	// Test: Bytes past the end of the body are kept
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhelloGET",
+		numBytesPerRead: 100,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	rest, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "GET", string(r.Buffered())+string(rest))
+
+	// Test: Nothing buffered when the request ends exactly
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Empty(t, r.Buffered())
+}
@@ -0,0 +1,119 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+const (
+	defaultHeader = "X-Request-ID"
+	maxIDLength   = 128
+)
+
+type Options struct {
+	// Header carries the ID in both directions. Defaults to X-Request-ID.
+	Header string
+	// Generate makes IDs for requests that don't bring a usable one. Defaults to NewID.
+	Generate func() string
+}
+
+// Middleware takes the request ID from the incoming header, or generates one, stores it in the
+// request's context, adds it to the response logger and echoes it in the response headers.
+func Middleware(opts Options) server.Middleware {
+	if opts.Header == "" {
+		opts.Header = defaultHeader
+	}
+	if opts.Generate == nil {
+		opts.Generate = NewID
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id, _ := req.Headers.Get(opts.Header)
+			if !validID(id) {
+				id = opts.Generate()
+			}
+
+			req = req.WithContext(request.ContextWithRequestID(req.Context(), id))
+			w.SetLogger(w.Logger().With("request_id", id))
+			w.AddFilter(func(_ response.StatusCode, h headers.Headers) func(io.Writer) io.WriteCloser {
+				h.Set(opts.Header, id)
+				return nil
+			})
+			next(w, req)
+		}
+	}
+}
+
+// validID accepts IDs of visible ASCII characters, so a client can't inject anything into logs or headers.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= 0x20 || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// crockford is Crockford's base32 alphabet, which sorts the same as the values it encodes.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	mu       sync.Mutex
+	lastMS   uint64
+	lastRand [10]byte
+)
+
+// NewID returns a 26 character ULID: a millisecond timestamp followed by 80 random bits.
+// IDs sort by creation time, and IDs made within the same millisecond still sort in creation order.
+func NewID() string {
+	mu.Lock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= lastMS {
+		// same millisecond (or the clock went back): count up from the previous ID
+		ms = lastMS
+		increment(&lastRand)
+	} else {
+		rand.Read(lastRand[:])
+		lastMS = ms
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	copy(b[6:], lastRand[:])
+	mu.Unlock()
+
+	return encode(b)
+}
+
+func increment(b *[10]byte) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
+
+// encode writes 128 bits as 26 base32 characters, the first one carrying only 3 bits.
+func encode(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,68 @@
+package requestid
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewID(t *testing.T) {
+	// Test: IDs are ULIDs that sort in creation order
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = NewID()
+	}
+	assert.Len(t, ids[0], 26)
+	assert.True(t, slices.IsSorted(ids))
+	assert.Len(t, slices.Compact(slices.Clone(ids)), len(ids))
+
+	// Test: Encoding
+	assert.Equal(t, "00000000000000000000000000", encode([16]byte{}))
+	ones := [16]byte{}
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encode(ones))
+}
+
+func TestMiddleware(t *testing.T) {
+	serve := func(opts Options, reqHeaders string) (string, *http.Response) {
+		req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" + reqHeaders + "\r\n"))
+		require.NoError(t, err)
+		var seen string
+		var buf bytes.Buffer
+		Middleware(opts)(func(w *response.Writer, req *request.Request) {
+			seen = req.RequestID()
+			w.WriteResponse(response.StatusOk, nil, nil)
+		})(&response.Writer{W: &buf}, req)
+		resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+		require.NoError(t, err)
+		return seen, resp
+	}
+
+	// Test: Incoming ID is kept and echoed
+	id, resp := serve(Options{}, "X-Request-ID: abc-123\r\n")
+	assert.Equal(t, "abc-123", id)
+	assert.Equal(t, "abc-123", resp.Header.Get("X-Request-ID"))
+
+	// Test: Missing or unusable IDs are replaced
+	id, resp = serve(Options{}, "")
+	assert.Len(t, id, 26)
+	assert.Equal(t, id, resp.Header.Get("X-Request-ID"))
+	id, _ = serve(Options{}, "X-Request-ID: "+strings.Repeat("a", 200)+"\r\n")
+	assert.Len(t, id, 26)
+
+	// Test: Custom header and generator
+	id, resp = serve(Options{Header: "X-Correlation-ID", Generate: func() string { return "fixed" }}, "X-Request-ID: ignored\r\n")
+	assert.Equal(t, "fixed", id)
+	assert.Equal(t, "fixed", resp.Header.Get("X-Correlation-ID"))
+	assert.Empty(t, resp.Header.Get("X-Request-ID"))
+}
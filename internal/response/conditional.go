@@ -0,0 +1,176 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+)
+
+// TimeFormat is the IMF-fixdate layout used in HTTP date headers.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var dateLayouts = []string{
+	TimeFormat,
+	time.RFC850,
+	time.ANSIC,
+}
+
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// ParseHTTPDate accepts the three date formats allowed by RFC 9110.
+func ParseHTTPDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP date: %q", s)
+}
+
+// StrongETag derives a strong entity tag from the representation bytes.
+func StrongETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag derives a weak entity tag from a modification time and size, e.g. for files.
+func WeakETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf(`W/"%x-%x"`, modTime.Unix(), size)
+}
+
+// SetValidators sets ETag and Last-Modified on h, skipping the empty ones.
+func SetValidators(h headers.Headers, etag string, lastModified time.Time) {
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", FormatHTTPDate(lastModified))
+	}
+}
+
+// EvaluatePreconditions checks the request's conditional headers against the current validators
+// following the order in RFC 9110 section 13.2.2. It returns StatusOk when the request should proceed,
+// or StatusNotModified / StatusPreconditionFailed.
+func EvaluatePreconditions(req *request.Request, etag string, lastModified time.Time) StatusCode {
+	method := req.RequestLine.Method
+	isGetOrHead := method == "GET" || method == "HEAD"
+	lastModified = lastModified.Truncate(time.Second)
+
+	if ifMatch, ok := req.Headers.Get("If-Match"); ok {
+		if !etagListMatches(ifMatch, etag, true) {
+			return StatusPreconditionFailed
+		}
+	} else if ius, ok := req.Headers.Get("If-Unmodified-Since"); ok && !lastModified.IsZero() {
+		t, err := ParseHTTPDate(ius)
+		if err == nil && lastModified.After(t) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch, ok := req.Headers.Get("If-None-Match"); ok {
+		if etagListMatches(ifNoneMatch, etag, false) {
+			if isGetOrHead {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if ims, ok := req.Headers.Get("If-Modified-Since"); ok && isGetOrHead && !lastModified.IsZero() {
+		t, err := ParseHTTPDate(ims)
+		if err == nil && !lastModified.After(t) {
+			return StatusNotModified
+		}
+	}
+
+	return StatusOk
+}
+
+// IfRangeMatches reports whether a Range header should be honoured. If-Range holds either an entity tag,
+// compared strongly, or a date that must exactly match the last modification time.
+func IfRangeMatches(req *request.Request, etag string, lastModified time.Time) bool {
+	ifRange, ok := req.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+	ifRange = strings.TrimSpace(ifRange)
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etagsMatch(ifRange, etag, true)
+	}
+
+	t, err := ParseHTTPDate(ifRange)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	return lastModified.Truncate(time.Second).Equal(t)
+}
+
+// WritePreconditions evaluates the request's conditional headers against the validators already set on h.
+// When the request must not proceed it writes a 304 (without a body) or a 412 and returns true.
+func (w *Writer) WritePreconditions(req *request.Request, h headers.Headers) bool {
+	etag, _ := h.Get("ETag")
+	var lastModified time.Time
+	if lm, ok := h.Get("Last-Modified"); ok {
+		lastModified, _ = ParseHTTPDate(lm)
+	}
+
+	switch EvaluatePreconditions(req, etag, lastModified) {
+	case StatusNotModified:
+		w.WriteNotModified(h)
+		return true
+	case StatusPreconditionFailed:
+		w.WriteResponse(StatusPreconditionFailed, nil, []byte("precondition failed\n"))
+		return true
+	}
+	return false
+}
+
+// WriteNotModified writes a 304 carrying only the headers that describe the cached representation.
+func (w *Writer) WriteNotModified(h headers.Headers) error {
+	out := headers.NewHeaders()
+	for _, key := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Vary", "Content-Location", "Date", "Connection"} {
+		if v, ok := h.Get(key); ok {
+			out.Set(key, v)
+		}
+	}
+
+	err := w.WriteStatusLine(StatusNotModified)
+	if err != nil {
+		return err
+	}
+	return w.WriteHeaders(out)
+}
+
+// etagListMatches checks an If-Match / If-None-Match value ("*" or a list of entity tags) against etag.
+func etagListMatches(list string, etag string, strong bool) bool {
+	list = strings.TrimSpace(list)
+	if list == "*" {
+		return etag != ""
+	}
+	for _, candidate := range headers.SplitList(list) {
+		if etagsMatch(candidate, etag, strong) {
+			return true
+		}
+	}
+	return false
+}
+
+func etagsMatch(a, b string, strong bool) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	aWeak := strings.HasPrefix(a, "W/")
+	bWeak := strings.HasPrefix(b, "W/")
+	if strong && (aWeak || bWeak) {
+		return false
+	}
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
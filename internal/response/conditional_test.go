@@ -0,0 +1,104 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(t *testing.T, method string, hdrs string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(method + " / HTTP/1.1\r\nHost: localhost\r\n" + hdrs + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	etag := `"abc"`
+	before := FormatHTTPDate(modTime.Add(-time.Hour))
+	after := FormatHTTPDate(modTime.Add(time.Hour))
+
+	// Test: No conditional headers
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", ""), etag, modTime))
+
+	// Test: If-None-Match with a matching tag, weak comparison
+	assert.Equal(t, StatusNotModified, EvaluatePreconditions(newRequest(t, "GET", "If-None-Match: \"xyz\", W/\"abc\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", "If-None-Match: \"xyz\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusNotModified, EvaluatePreconditions(newRequest(t, "GET", "If-None-Match: \"x,y\",, W/\"abc\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", "If-None-Match: \"abc,\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusNotModified, EvaluatePreconditions(newRequest(t, "HEAD", "If-None-Match: *\r\n"), etag, modTime))
+
+	// Test: If-None-Match on an unsafe method fails the precondition
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newRequest(t, "PUT", "If-None-Match: *\r\n"), etag, modTime))
+
+	// Test: If-None-Match takes precedence over If-Modified-Since
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", "If-None-Match: \"xyz\"\r\nIf-Modified-Since: "+after+"\r\n"), etag, modTime))
+
+	// Test: If-Modified-Since
+	assert.Equal(t, StatusNotModified, EvaluatePreconditions(newRequest(t, "GET", "If-Modified-Since: "+FormatHTTPDate(modTime)+"\r\n"), etag, modTime.Add(500*time.Millisecond)))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", "If-Modified-Since: "+before+"\r\n"), etag, modTime))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "GET", "If-Modified-Since: yesterday\r\n"), etag, modTime))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "POST", "If-Modified-Since: "+after+"\r\n"), etag, modTime))
+
+	// Test: If-Match uses strong comparison
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "PUT", "If-Match: \"abc\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newRequest(t, "PUT", "If-Match: W/\"abc\"\r\n"), etag, modTime))
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newRequest(t, "PUT", "If-Match: *\r\n"), "", modTime))
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "PUT", "If-Match: \"abc\"\r\nIf-Unmodified-Since: "+before+"\r\n"), etag, modTime))
+
+	// Test: If-Unmodified-Since
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newRequest(t, "PUT", "If-Unmodified-Since: "+before+"\r\n"), etag, modTime))
+	assert.Equal(t, StatusOk, EvaluatePreconditions(newRequest(t, "PUT", "If-Unmodified-Since: "+after+"\r\n"), etag, modTime))
+
+	// Test: If-Match is evaluated before If-None-Match
+	assert.Equal(t, StatusPreconditionFailed, EvaluatePreconditions(newRequest(t, "GET", "If-Match: \"xyz\"\r\nIf-None-Match: \"abc\"\r\n"), etag, modTime))
+}
+
+func TestParseHTTPDate(t *testing.T) {
+	want := time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)
+	for _, s := range []string{"Sun, 06 Nov 1994 08:49:37 GMT", "Sunday, 06-Nov-94 08:49:37 GMT", "Sun Nov  6 08:49:37 1994"} {
+		got, err := ParseHTTPDate(s)
+		require.NoError(t, err, s)
+		assert.True(t, want.Equal(got), s)
+	}
+	_, err := ParseHTTPDate("not a date")
+	assert.Error(t, err)
+}
+
+func TestWritePreconditions(t *testing.T) {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	body := []byte("hello")
+
+	// Test: 304 carries validators but no body
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	h := GetDefaultHeaders(len(body))
+	SetValidators(h, StrongETag(body), modTime)
+	req := newRequest(t, "GET", "If-None-Match: "+StrongETag(body)+"\r\n")
+	require.True(t, w.WritePreconditions(req, h))
+	resp := buf.String()
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, resp, "etag: "+StrongETag(body)+"\r\n")
+	assert.Contains(t, resp, "last-modified: Mon, 06 May 2024 07:08:09 GMT\r\n")
+	assert.NotContains(t, resp, "content-length")
+	assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"))
+
+	// Test: 412 on failed If-Match
+	buf.Reset()
+	req = newRequest(t, "PUT", "If-Match: \"other\"\r\n")
+	require.True(t, w.WritePreconditions(req, h))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 412 Precondition Failed\r\n"))
+
+	// Test: Nothing written when the request may proceed
+	buf.Reset()
+	req = newRequest(t, "GET", "")
+	require.False(t, w.WritePreconditions(req, h))
+	assert.Empty(t, buf.String())
+}
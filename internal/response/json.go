@@ -0,0 +1,81 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+)
+
+// WriteJSON writes v as an application/json response.
+func (w *Writer) WriteJSON(statusCode StatusCode, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON response: %v", err)
+	}
+	h := GetDefaultHeaders(0)
+	h.Set("Content-Type", "application/json")
+	return w.WriteResponse(statusCode, h, body)
+}
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	// Type is a URI identifying the problem type. Empty means "about:blank".
+	Type     string
+	Title    string
+	Status   StatusCode
+	Detail   string
+	Instance string
+	// Extensions are additional members, they can't override the standard ones.
+	Extensions map[string]any
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := map[string]any{}
+	maps.Copy(m, p.Extensions)
+	m["type"] = p.Type
+	if p.Type == "" {
+		m["type"] = "about:blank"
+	}
+	m["status"] = p.Status
+	m["title"] = p.Title
+	if p.Title == "" {
+		m["title"] = StatusText(p.Status)
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// WriteProblem writes p as an application/problem+json response with p.Status as the status code.
+func (w *Writer) WriteProblem(p Problem) error {
+	if p.Status == 0 {
+		p.Status = StatusInternalError
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode problem: %v", err)
+	}
+	h := GetDefaultHeaders(0)
+	h.Set("Content-Type", "application/problem+json")
+	return w.WriteResponse(p.Status, h, body)
+}
+
+// WriteDecodeError reports an error from Request.DecodeJSON: 415 for the wrong Content-Type,
+// 413 for an oversized body and 400 for anything else.
+func (w *Writer) WriteDecodeError(err error) error {
+	p := Problem{Status: StatusBadRequest, Detail: err.Error()}
+	switch {
+	case errors.Is(err, request.ErrNotJSON):
+		p.Status = StatusUnsupportedMediaType
+	case errors.Is(err, request.ErrJSONTooLarge):
+		p.Status = StatusContentTooLarge
+	}
+	return w.WriteProblem(p)
+}
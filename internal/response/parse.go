@@ -0,0 +1,373 @@
+package response
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+const (
+	crlf             = "\r\n"
+	bufferSize       = 8
+	maxChunkSizeLine = 4096
+)
+
+type responseState int
+
+const (
+	responseStateInitialized responseState = iota
+	responseStateParsingHeaders
+	responseStateParsingBody
+	responseStateParsingChunkSize
+	responseStateParsingChunkData
+	responseStateParsingChunkEnd
+	responseStateParsingTrailers
+	responseStateDone
+)
+
+type bodyFraming int
+
+const (
+	framingNone bodyFraming = iota
+	framingLength
+	framingChunked
+	framingClose
+)
+
+// Response is a parsed HTTP response, the client side counterpart of request.Request.
+type Response struct {
+	StatusLine StatusLine
+	Headers    headers.Headers
+	// SetCookies holds each Set-Cookie value separately, since they can't be comma-joined into Headers.
+	SetCookies  []string
+	Body        []byte
+	Trailers    headers.Headers
+	ParserState responseState
+
+	method         string
+	framing        bodyFraming
+	contentLength  int
+	chunkRemaining int
+	buffered       []byte
+}
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+// ResponseFromReader parses a complete response: status line, headers and a body framed by
+// Content-Length, chunked encoding or the end of the stream. Interim 1xx responses are skipped.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	return ResponseFromReaderForMethod(reader, "")
+}
+
+// ResponseFromReaderForMethod is ResponseFromReader for a response to a request made with method,
+// which matters for HEAD: its response has headers describing a body that isn't sent.
+func ResponseFromReaderForMethod(reader io.Reader, method string) (*Response, error) {
+	buffer := make([]byte, bufferSize)
+	readToIndex := 0
+
+	resp := newResponse(method)
+
+	for resp.ParserState != responseStateDone {
+		if readToIndex >= len(buffer) {
+			newbuf := make([]byte, 2*len(buffer))
+			copy(newbuf, buffer)
+			buffer = newbuf
+		}
+
+		n, readErr := reader.Read(buffer[readToIndex:])
+		readToIndex += n
+
+		n, err := resp.parse(buffer[:readToIndex])
+		if err != nil {
+			return nil, err
+		}
+		copy(buffer, buffer[n:readToIndex])
+		readToIndex -= n
+
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				return nil, readErr
+			}
+			if resp.ParserState == responseStateParsingBody && resp.framing == framingClose {
+				resp.ParserState = responseStateDone
+			}
+			if resp.ParserState != responseStateDone {
+				return nil, fmt.Errorf("incomplete response, in state: %d: %w", resp.ParserState, io.ErrUnexpectedEOF)
+			}
+		}
+	}
+
+	if readToIndex > 0 {
+		resp.buffered = make([]byte, readToIndex)
+		copy(resp.buffered, buffer[:readToIndex])
+	}
+
+	return resp, nil
+}
+
+func newResponse(method string) *Response {
+	return &Response{
+		Headers:     headers.NewHeaders(),
+		Trailers:    headers.NewHeaders(),
+		ParserState: responseStateInitialized,
+		method:      method,
+	}
+}
+
+// Buffered returns bytes that were read past the end of the response.
+func (r *Response) Buffered() []byte {
+	return r.buffered
+}
+
+// ParseStatusLine parses "HTTP/1.1 200 OK". The reason phrase is optional, and so is the space before it.
+func ParseStatusLine(line string) (*StatusLine, error) {
+	version, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return nil, fmt.Errorf("bad status-line: %q", line)
+	}
+	if version != "HTTP/1.1" && version != "HTTP/1.0" {
+		return nil, fmt.Errorf("unsupported HTTP version: %q", version)
+	}
+
+	code, reason, _ := strings.Cut(rest, " ")
+	if len(code) != 3 || strings.Trim(code, "0123456789") != "" || code[0] == '0' {
+		return nil, fmt.Errorf("invalid status code: %q", code)
+	}
+	n, _ := strconv.Atoi(code)
+	for i := 0; i < len(reason); i++ {
+		if (reason[i] < 0x20 && reason[i] != '\t') || reason[i] == 0x7f {
+			return nil, fmt.Errorf("invalid reason phrase: %q", reason)
+		}
+	}
+
+	return &StatusLine{
+		HttpVersion:  strings.TrimPrefix(version, "HTTP/"),
+		StatusCode:   StatusCode(n),
+		ReasonPhrase: reason,
+	}, nil
+}
+
+// ParseContentLength accepts a single length, or a list of identical ones left by repeated headers.
+func ParseContentLength(s string) (int64, error) {
+	var n int64 = -1
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || strings.Trim(v, "0123456789") != "" {
+			return 0, fmt.Errorf("invalid Content-Length: %q", s)
+		}
+		l, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || (n >= 0 && l != n) {
+			return 0, fmt.Errorf("invalid Content-Length: %q", s)
+		}
+		n = l
+	}
+	return n, nil
+}
+
+// HasBody reports whether a response with this status to a request with this method carries a body.
+func HasBody(method string, statusCode StatusCode) bool {
+	return method != "HEAD" && statusCode >= 200 && statusCode != StatusNoContent && statusCode != StatusNotModified
+}
+
+// IsChunkedFraming reports whether chunked is the final transfer coding, which is what frames a body.
+// Any other Transfer-Encoding leaves the body running until the connection closes.
+func IsChunkedFraming(h headers.Headers) bool {
+	te, ok := h.Get("Transfer-Encoding")
+	if !ok {
+		return false
+	}
+	codings := headers.SplitList(te)
+	return len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked")
+}
+
+// ParseHeaderLine parses one header line into h like headers.Headers.Parse, except that Set-Cookie
+// values are returned instead of being comma-joined.
+func ParseHeaderLine(h headers.Headers, data []byte) (n int, done bool, setCookie string, err error) {
+	field := headers.NewHeaders()
+	n, done, err = field.Parse(data)
+	if err != nil || done || n == 0 {
+		return n, done, "", err
+	}
+	for k, v := range field {
+		if k == "set-cookie" {
+			return n, false, v, nil
+		}
+		if old, ok := h[k]; ok {
+			v = old + ", " + v
+		}
+		h[k] = v
+	}
+	return n, false, "", nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+	for r.ParserState != responseStateDone {
+		n, err := r.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return 0, err
+		}
+		totalBytesParsed += n
+		if n == 0 && r.ParserState != responseStateDone {
+			break
+		}
+	}
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.ParserState {
+	case responseStateInitialized:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			return 0, nil
+		}
+		sl, err := ParseStatusLine(string(data[:idx]))
+		if err != nil {
+			return 0, err
+		}
+		r.StatusLine = *sl
+		r.ParserState = responseStateParsingHeaders
+		return idx + 2, nil
+	case responseStateParsingHeaders:
+		n, done, cookie, err := ParseHeaderLine(r.Headers, data)
+		if err != nil {
+			return 0, err
+		}
+		if cookie != "" {
+			r.SetCookies = append(r.SetCookies, cookie)
+		}
+		if done {
+			return n, r.startBody()
+		}
+		return n, nil
+	case responseStateParsingBody:
+		switch r.framing {
+		case framingLength:
+			n := min(r.contentLength-len(r.Body), len(data))
+			r.Body = append(r.Body, data[:n]...)
+			if len(r.Body) == r.contentLength {
+				r.ParserState = responseStateDone
+			}
+			return n, nil
+		case framingClose:
+			r.Body = append(r.Body, data...)
+			return len(data), nil
+		}
+		r.ParserState = responseStateDone
+		return 0, nil
+	case responseStateParsingChunkSize:
+		idx := bytes.Index(data, []byte(crlf))
+		if idx == -1 {
+			if len(data) > maxChunkSizeLine {
+				return 0, fmt.Errorf("chunk size line too long")
+			}
+			return 0, nil
+		}
+		size, err := ParseChunkSize(string(data[:idx]))
+		if err != nil {
+			return 0, err
+		}
+		r.chunkRemaining = int(size)
+		if size == 0 {
+			r.ParserState = responseStateParsingTrailers
+		} else {
+			r.ParserState = responseStateParsingChunkData
+		}
+		return idx + 2, nil
+	case responseStateParsingChunkData:
+		n := min(r.chunkRemaining, len(data))
+		r.Body = append(r.Body, data[:n]...)
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.ParserState = responseStateParsingChunkEnd
+		}
+		return n, nil
+	case responseStateParsingChunkEnd:
+		if len(data) < 2 {
+			return 0, nil
+		}
+		if string(data[:2]) != crlf {
+			return 0, fmt.Errorf("malformed chunk: missing CRLF after data")
+		}
+		r.ParserState = responseStateParsingChunkSize
+		return 2, nil
+	case responseStateParsingTrailers:
+		// Set-Cookie isn't allowed in trailers, so any that show up are dropped
+		n, done, _, err := ParseHeaderLine(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			r.ParserState = responseStateDone
+		}
+		return n, nil
+	case responseStateDone:
+		return 0, fmt.Errorf("error: trying to read data in a done state")
+	default:
+		return 0, fmt.Errorf("error: unknown parser state")
+	}
+}
+
+// startBody picks the body framing once the headers are complete. An interim 1xx response
+// sends the parser back to the status line of the next one.
+func (r *Response) startBody() error {
+	code := r.StatusLine.StatusCode
+	if code < 200 && code != StatusSwitchingProtocols {
+		*r = *newResponse(r.method)
+		return nil
+	}
+
+	r.ParserState = responseStateParsingBody
+	switch {
+	case !HasBody(r.method, code):
+		r.framing = framingNone
+	case IsChunkedFraming(r.Headers):
+		r.framing = framingChunked
+		r.ParserState = responseStateParsingChunkSize
+	case hasHeader(r.Headers, "Transfer-Encoding"):
+		r.framing = framingClose
+	case hasHeader(r.Headers, "Content-Length"):
+		cl, _ := r.Headers.Get("Content-Length")
+		n, err := ParseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		r.framing = framingLength
+		r.contentLength = int(n)
+		if n == 0 {
+			r.ParserState = responseStateDone
+		}
+	default:
+		r.framing = framingClose
+	}
+	return nil
+}
+
+// ParseChunkSize parses a chunk-size line, ignoring any chunk extensions.
+func ParseChunkSize(line string) (int64, error) {
+	size, _, _ := strings.Cut(line, ";")
+	size = strings.TrimSpace(size)
+	if size == "" || len(size) > 15 || strings.Trim(size, "0123456789abcdefABCDEF") != "" {
+		return 0, fmt.Errorf("malformed chunk size: %q", line)
+	}
+	n, err := strconv.ParseInt(size, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed chunk size: %q", line)
+	}
+	return n, nil
+}
+
+func hasHeader(h headers.Headers, key string) bool {
+	_, ok := h.Get(key)
+	return ok
+}
@@ -0,0 +1,243 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+	return n, nil
+}
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.1", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusOk, r.StatusLine.StatusCode)
+	assert.Equal(t, "OK", r.StatusLine.ReasonPhrase)
+
+	// Test: Reason phrase with spaces, HTTP/1.0
+	reader = &chunkReader{
+		data:            "HTTP/1.0 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusNotFound, r.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found", r.StatusLine.ReasonPhrase)
+
+	// Test: Empty or missing reason phrase
+	for _, line := range []string{"HTTP/1.1 299 ", "HTTP/1.1 299"} {
+		r, err = ResponseFromReader(&chunkReader{data: line + "\r\nContent-Length: 0\r\n\r\n", numBytesPerRead: 4})
+		require.NoError(t, err, line)
+		assert.Equal(t, StatusCode(299), r.StatusLine.StatusCode)
+		assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+	}
+
+	// Test: Invalid status lines
+	for _, line := range []string{
+		"HTTP/2 200 OK",
+		"HTTP/1.1 20 OK",
+		"HTTP/1.1 2000 OK",
+		"HTTP/1.1 abc OK",
+		"HTTP/1.1 099 OK",
+		"HTTP/1.1 +20 OK",
+		"HTTP/1.1 200 O\x01K",
+		"200 OK",
+	} {
+		_, err = ResponseFromReader(&chunkReader{data: line + "\r\n\r\n", numBytesPerRead: 5})
+		assert.Error(t, err, line)
+	}
+}
+
+func TestResponseHeadersParse(t *testing.T) {
+	// Test: Standard headers, Set-Cookie kept apart
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nSet-Cookie: a=1; Path=/\r\n" +
+			"Set-Cookie: b=2\r\nVia: 1.1 a\r\nVia: 1.1 b\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", r.Headers["content-type"])
+	assert.Equal(t, "1.1 a, 1.1 b", r.Headers["via"])
+	assert.Equal(t, []string{"a=1; Path=/", "b=2"}, r.SetCookies)
+	assert.NotContains(t, r.Headers, "set-cookie")
+
+	// Test: Malformed header
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nBad Header: x\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing end of headers
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Interim responses are skipped
+	reader = &chunkReader{
+		data:            "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok",
+		numBytesPerRead: 7,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(201), r.StatusLine.StatusCode)
+	assert.NotContains(t, r.Headers, "link")
+	assert.Equal(t, "ok", string(r.Body))
+}
+
+func TestResponseBodyParse(t *testing.T) {
+	// Test: Content-Length body
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Body shorter than Content-Length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\npartial content",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Invalid Content-Length
+	for _, cl := range []string{"-1", "abc", "+5", "5, 6"} {
+		reader = &chunkReader{
+			data:            "HTTP/1.1 200 OK\r\nContent-Length: " + cl + "\r\n\r\nhello",
+			numBytesPerRead: 3,
+		}
+		_, err = ResponseFromReader(reader)
+		require.Error(t, err, cl)
+	}
+
+	// Test: Repeated identical Content-Length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Chunked body with extensions and trailers
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+			"5;name=value\r\nhello\r\nA\r\n, world!!!\r\n0\r\nX-Sum: abc\r\n\r\n",
+		numBytesPerRead: 2,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world!!!", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers["x-sum"])
+
+	// Test: Chunked wins over Content-Length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: gzip, chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+
+	// Test: Malformed chunks
+	for _, body := range []string{"zz\r\nabc\r\n0\r\n\r\n", "3\r\nabcX\r\n0\r\n\r\n", "3\r\nabc\r\n"} {
+		reader = &chunkReader{
+			data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" + body,
+			numBytesPerRead: 3,
+		}
+		_, err = ResponseFromReader(reader)
+		require.Error(t, err, body)
+	}
+
+	// Test: Body delimited by the end of the stream
+	reader = &chunkReader{
+		data:            "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the connection closes",
+		numBytesPerRead: 5,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "until the connection closes", string(r.Body))
+
+	// Test: No body for 204, 304 and HEAD, extra bytes are kept
+	reader = &chunkReader{
+		data:            "HTTP/1.1 204 No Content\r\n\r\nHTTP/1.1 200 OK\r\n",
+		numBytesPerRead: 100,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	assert.NotEmpty(t, r.Buffered())
+	assert.True(t, strings.HasPrefix("HTTP/1.1 200 OK\r\n", string(r.Buffered())))
+
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 42\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReaderForMethod(reader, "HEAD")
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	assert.Equal(t, "42", r.Headers["content-length"])
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	// Test: What the Writer sends parses back, trailers included
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	h := GetDefaultHeaders(0)
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Count")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("first "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("second"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	h.Set("X-Count", "2")
+	require.NoError(t, w.WriteTrailers(h))
+
+	r, err := ResponseFromReader(&chunkReader{data: buf.String(), numBytesPerRead: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "first second", string(r.Body))
+	assert.Equal(t, "2", r.Trailers["x-count"])
+}
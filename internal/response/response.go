@@ -1,8 +1,11 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"strconv"
 	"strings"
 
@@ -12,30 +15,281 @@ import (
 type StatusCode int
 
 const (
-	StatusOk            StatusCode = 200
-	StatusBadRequest    StatusCode = 400
-	StatusInternalError StatusCode = 500
+	StatusSwitchingProtocols   StatusCode = 101
+	StatusOk                   StatusCode = 200
+	StatusNoContent            StatusCode = 204
+	StatusPartialContent       StatusCode = 206
+	StatusMovedPermanently     StatusCode = 301
+	StatusNotModified          StatusCode = 304
+	StatusBadRequest           StatusCode = 400
+	StatusForbidden            StatusCode = 403
+	StatusNotFound             StatusCode = 404
+	StatusMethodNotAllowed     StatusCode = 405
+	StatusNotAcceptable        StatusCode = 406
+	StatusPreconditionFailed   StatusCode = 412
+	StatusContentTooLarge      StatusCode = 413
+	StatusUnsupportedMediaType StatusCode = 415
+	StatusRangeNotSatisfiable  StatusCode = 416
+	StatusUpgradeRequired      StatusCode = 426
+	StatusInternalError        StatusCode = 500
+	StatusBadGateway           StatusCode = 502
+	StatusGatewayTimeout       StatusCode = 504
 )
 
+var statusText = map[StatusCode]string{
+	StatusSwitchingProtocols:   "Switching Protocols",
+	StatusOk:                   "OK",
+	StatusNoContent:            "No Content",
+	StatusPartialContent:       "Partial Content",
+	StatusMovedPermanently:     "Moved Permanently",
+	StatusNotModified:          "Not Modified",
+	StatusBadRequest:           "Bad Request",
+	StatusForbidden:            "Forbidden",
+	StatusNotFound:             "Not Found",
+	StatusMethodNotAllowed:     "Method Not Allowed",
+	StatusNotAcceptable:        "Not Acceptable",
+	StatusPreconditionFailed:   "Precondition Failed",
+	StatusContentTooLarge:      "Content Too Large",
+	StatusUnsupportedMediaType: "Unsupported Media Type",
+	StatusRangeNotSatisfiable:  "Range Not Satisfiable",
+	StatusUpgradeRequired:      "Upgrade Required",
+	StatusInternalError:        "Internal Server Error",
+	StatusBadGateway:           "Bad Gateway",
+	StatusGatewayTimeout:       "Gateway Timeout",
+}
+
+// StatusText returns the reason phrase for a status code, or an empty string if it is unknown.
+func StatusText(code StatusCode) string {
+	return statusText[code]
+}
+
+var (
+	ErrHijacked      = errors.New("connection has been hijacked")
+	ErrNotHijackable = errors.New("writer has no underlying connection")
+	ErrHeadersSent   = errors.New("headers have already been written")
+)
+
+// BodyFilter is called right before the response headers are sent. It may modify h and returns a function
+// wrapping the body stream, or nil to leave the body untouched. Filters are installed by middleware.
+type BodyFilter func(statusCode StatusCode, h headers.Headers) func(body io.Writer) io.WriteCloser
+
 type Writer struct {
-	W io.Writer
+	W        io.Writer
+	conn     net.Conn
+	buffered []byte
+	hijacked bool
+	onHijack func() []byte
+	logger   *slog.Logger
+
+	status         StatusCode
+	headersWritten bool
+	chunked        bool
+	autoChunked    bool
+	closed         bool
+
+	filters []BodyFilter
+	body    io.Writer
+	closers []io.Closer
+	cookies []string
+
+	bodyBytes int64
+}
+
+func NewWriter(conn net.Conn) *Writer {
+	return &Writer{
+		W:    conn,
+		conn: conn,
+	}
+}
+
+// SetBuffered records bytes the request parser read past the end of the request, to be handed out by Hijack.
+func (w *Writer) SetBuffered(p []byte) {
+	w.buffered = p
+}
+
+// Hijack hands the underlying connection over to the caller, together with any bytes that were
+// already read from it but not consumed by the request parser.
+// After a successful call the Writer can no longer be used and the server stops managing the connection:
+// it will not close it, reuse it or apply timeouts to it.
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.hijacked {
+		return nil, nil, ErrHijacked
+	}
+	if w.conn == nil {
+		return nil, nil, ErrNotHijackable
+	}
+	w.hijacked = true
+	buffered := w.buffered
+	w.buffered = nil
+	if w.onHijack != nil {
+		buffered = append(buffered, w.onHijack()...)
+	}
+	return w.conn, buffered, nil
+}
+
+// OnHijack registers f to run when the connection is hijacked. Whatever f returns is handed out
+// after the bytes given to SetBuffered. The server uses it to stop reading from the connection.
+func (w *Writer) OnHijack(f func() []byte) {
+	w.onHijack = f
+}
+
+// SetLogger sets the logger returned by Logger. The server sets one carrying the connection's attributes.
+func (w *Writer) SetLogger(l *slog.Logger) {
+	w.logger = l
+}
+
+// Logger returns the logger for this response, which discards everything if none was set.
+func (w *Writer) Logger() *slog.Logger {
+	if w.logger == nil {
+		return discardLogger
+	}
+	return w.logger
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+func (w *Writer) Hijacked() bool {
+	return w.hijacked
+}
+
+// StatusCode returns the status written so far, or 0 if no status line was written.
+func (w *Writer) StatusCode() StatusCode {
+	return w.status
+}
+
+// BytesWritten returns the number of body bytes sent so far, after body filters and without chunk framing.
+func (w *Writer) BytesWritten() int64 {
+	return w.bodyBytes
+}
+
+// AddFilter installs a BodyFilter. It has no effect once the headers have been written.
+// Filters added first end up closest to the handler.
+func (w *Writer) AddFilter(f BodyFilter) {
+	w.filters = append(w.filters, f)
+}
+
+// SetCookie queues a Set-Cookie line to be sent with the response headers.
+// Each cookie gets its own line since Set-Cookie values can't be comma-joined.
+func (w *Writer) SetCookie(c *headers.Cookie) error {
+	if w.headersWritten {
+		return ErrHeadersSent
+	}
+	err := c.Valid()
+	if err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, c.String())
+	return nil
+}
+
+// SetRawCookie queues an already formatted Set-Cookie value, such as one relayed from another server.
+func (w *Writer) SetRawCookie(value string) error {
+	if w.headersWritten {
+		return ErrHeadersSent
+	}
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("invalid Set-Cookie value: %q", value)
+	}
+	w.cookies = append(w.cookies, value)
+	return nil
+}
+
+// Close flushes any body filters and, if a filter switched the response to chunked encoding,
+// terminates the chunked body. The server calls it once the handler returns.
+func (w *Writer) Close() error {
+	if w.hijacked || w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.closeFilters()
+	if err != nil {
+		return err
+	}
+	if w.autoChunked {
+		_, err = w.W.Write([]byte("0\r\n\r\n"))
+		if err != nil {
+			return fmt.Errorf("failed to write end of chunked body: %v", err)
+		}
+	}
+	return nil
+}
+
+// prepareBody runs the filters over the response headers and builds the body pipeline:
+// filters on top, chunk framing (when the headers ask for it) underneath.
+func (w *Writer) prepareBody(h headers.Headers) {
+	handlerChunked := isChunked(h)
+
+	var wraps []func(io.Writer) io.WriteCloser
+	for _, f := range w.filters {
+		if wrap := f(w.status, h); wrap != nil {
+			wraps = append(wraps, wrap)
+		}
+	}
+
+	w.chunked = isChunked(h)
+	w.autoChunked = w.chunked && !handlerChunked
+
+	var body io.Writer = w.W
+	if w.chunked {
+		body = chunkWriter{w.W}
+	}
+	body = countWriter{body, &w.bodyBytes}
+	w.closers = make([]io.Closer, len(wraps))
+	for i := len(wraps) - 1; i >= 0; i-- {
+		wc := wraps[i](body)
+		w.closers[i] = wc
+		body = wc
+	}
+	w.body = body
+}
+
+func (w *Writer) closeFilters() error {
+	closers := w.closers
+	w.closers = nil
+	for _, c := range closers {
+		err := c.Close()
+		if err != nil {
+			return fmt.Errorf("failed to flush body: %v", err)
+		}
+	}
+	return nil
+}
+
+func isChunked(h headers.Headers) bool {
+	te, ok := h.Get("Transfer-Encoding")
+	return ok && strings.Contains(strings.ToLower(te), "chunked")
+}
+
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// chunkWriter frames everything written to it as HTTP/1.1 chunks.
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	l := strings.ToUpper(strconv.FormatInt(int64(len(p)), 16))
+	_, err := cw.w.Write([]byte(l + "\r\n" + string(p) + "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	var statusLine string
-	switch statusCode {
-	case StatusOk:
-		statusLine = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		statusLine = "HTTP/1.1 400 Bad Request"
-	case StatusInternalError:
-		statusLine = "HTTP/1.1 500 Internal Server Error"
-	default:
-		code := strconv.Itoa(int(statusCode))
-		statusLine = "HTTP/1.1 " + code + " "
-	}
-
-	statusLine = statusLine + "\r\n"
+	statusLine := "HTTP/1.1 " + strconv.Itoa(int(statusCode)) + " " + StatusText(statusCode) + "\r\n"
 	_, err := w.Write([]byte(statusLine))
 	if err != nil {
 		return fmt.Errorf("failed to write status line: %v", err)
@@ -78,20 +332,11 @@ func WriteBody(w io.Writer, body []byte) error {
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	var statusLine string
-	switch statusCode {
-	case StatusOk:
-		statusLine = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		statusLine = "HTTP/1.1 400 Bad Request"
-	case StatusInternalError:
-		statusLine = "HTTP/1.1 500 Internal Server Error"
-	default:
-		code := strconv.Itoa(int(statusCode))
-		statusLine = "HTTP/1.1 " + code + " "
-	}
-
-	statusLine = statusLine + "\r\n"
+	if w.hijacked {
+		return ErrHijacked
+	}
+	w.status = statusCode
+	statusLine := "HTTP/1.1 " + strconv.Itoa(int(statusCode)) + " " + StatusText(statusCode) + "\r\n"
 	_, err := w.W.Write([]byte(statusLine))
 	if err != nil {
 		return fmt.Errorf("failed to write status line: %v", err)
@@ -100,6 +345,17 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 }
 
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
+	if w.hijacked {
+		return ErrHijacked
+	}
+	// the first header block is the response's own, later ones are trailers
+	var cookies []string
+	if !w.headersWritten {
+		// filters may still call SetCookie
+		w.prepareBody(headers)
+		w.headersWritten = true
+		cookies = w.cookies
+	}
 	for k, v := range headers {
 		hh := k + ": " + v + "\r\n"
 		_, err := w.W.Write([]byte(hh))
@@ -107,6 +363,12 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 			return fmt.Errorf("failed to write header line: %v", err)
 		}
 	}
+	for _, c := range cookies {
+		_, err := w.W.Write([]byte("set-cookie: " + c + "\r\n"))
+		if err != nil {
+			return fmt.Errorf("failed to write header line: %v", err)
+		}
+	}
 	_, err := w.W.Write([]byte("\r\n"))
 	if err != nil {
 		return fmt.Errorf("failed to write end of headers: %v", err)
@@ -115,20 +377,65 @@ func (w *Writer) WriteHeaders(headers headers.Headers) error {
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	n, err := w.W.Write(p)
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	dst := w.body
+	if dst == nil {
+		dst = countWriter{w.W, &w.bodyBytes}
+	}
+	n, err := dst.Write(p)
 	if err != nil {
 		return 0, fmt.Errorf("failed to write body: %v", err)
 	}
 	return n, nil
 }
 
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.WriteBody(p)
+}
+
+// WriteResponse writes a complete response with the given headers, setting Content-Length from body.
+// Default headers are used when h is nil.
+func (w *Writer) WriteResponse(statusCode StatusCode, h headers.Headers, body []byte) error {
+	if h == nil {
+		h = GetDefaultHeaders(0)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteBody(body)
+	return err
+}
+
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	if w.chunked {
+		return w.WriteBody(p)
+	}
 	l := strings.ToUpper(strconv.FormatInt(int64(len(p)), 16))
 	msg := l + "\r\n" + string(p) + "\r\n"
+	w.bodyBytes += int64(len(p))
 	return w.W.Write([]byte(msg))
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	err := w.closeFilters()
+	if err != nil {
+		return 0, err
+	}
 	return w.W.Write([]byte("0\r\n"))
 }
 
@@ -0,0 +1,94 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCookie(t *testing.T) {
+	// Test: Each cookie gets its own Set-Cookie line
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	require.NoError(t, w.SetCookie(&headers.Cookie{Name: "a", Value: "1", Path: "/", HttpOnly: true}))
+	require.NoError(t, w.SetCookie(&headers.Cookie{Name: "b", Value: "2", SameSite: headers.SameSiteStrict}))
+	require.NoError(t, w.WriteResponse(StatusOk, nil, []byte("ok")))
+
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Path=/; HttpOnly", "b=2; SameSite=Strict"}, resp.Header.Values("Set-Cookie"))
+
+	// Test: Invalid cookies are rejected
+	w = &Writer{W: &buf}
+	assert.ErrorIs(t, w.SetCookie(&headers.Cookie{Name: "a b"}), headers.ErrInvalidCookieName)
+
+	// Test: Too late once headers are out
+	w.WriteStatusLine(StatusOk)
+	w.WriteHeaders(GetDefaultHeaders(0))
+	assert.ErrorIs(t, w.SetCookie(&headers.Cookie{Name: "late", Value: "1"}), ErrHeadersSent)
+}
+
+func readResponse(t *testing.T, buf *bytes.Buffer) (*http.Response, []byte) {
+	resp, err := http.ReadResponse(bufio.NewReader(buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestWriteJSON(t *testing.T) {
+	// Test: Value with headers and Content-Length
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	require.NoError(t, w.WriteJSON(StatusOk, map[string]int{"count": 3}))
+	resp, body := readResponse(t, &buf)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	assert.Equal(t, int64(len(body)), w.BytesWritten())
+	assert.JSONEq(t, `{"count":3}`, string(body))
+
+	// Test: Unencodable values are reported before anything is written
+	w = &Writer{W: &buf}
+	assert.Error(t, w.WriteJSON(StatusOk, make(chan int)))
+	assert.Zero(t, buf.Len())
+}
+
+func TestWriteProblem(t *testing.T) {
+	// Test: Defaults and extensions
+	var buf bytes.Buffer
+	w := &Writer{W: &buf}
+	require.NoError(t, w.WriteProblem(Problem{
+		Status:     StatusForbidden,
+		Detail:     "no access",
+		Extensions: map[string]any{"balance": 30, "status": "ignored"},
+	}))
+	resp, body := readResponse(t, &buf)
+	assert.Equal(t, 403, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"no access","balance":30}`, string(body))
+
+	// Test: Decode errors map to status codes
+	for err, code := range map[error]int{
+		request.ErrNotJSON:              415,
+		request.ErrJSONTooLarge:         413,
+		errors.New("invalid JSON body"): 400,
+	} {
+		buf.Reset()
+		w = &Writer{W: &buf}
+		require.NoError(t, w.WriteDecodeError(err))
+		resp, body = readResponse(t, &buf)
+		assert.Equal(t, code, resp.StatusCode)
+		var p map[string]any
+		require.NoError(t, json.Unmarshal(body, &p))
+		assert.Equal(t, err.Error(), p["detail"])
+	}
+}
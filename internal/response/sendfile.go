@@ -0,0 +1,38 @@
+package response
+
+import (
+	"io"
+	"net"
+)
+
+const copyBufferSize = 32 * 1024
+
+// tcpReadFrom is the fast path of ReadFrom; tests replace it to see whether it was taken.
+var tcpReadFrom = (*net.TCPConn).ReadFrom
+
+// ReadFrom copies r into the response body. When the body is not chunked and the Writer sits directly on a
+// *net.TCPConn, the copy is handed to the connection, which uses sendfile/splice for *os.File sources on Linux.
+// Anything else (TLS, wrapped writers, chunked output, body filters) falls back to a buffered copy.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	if !w.chunked && len(w.closers) == 0 {
+		if tcpConn, ok := w.W.(*net.TCPConn); ok {
+			n, err := tcpReadFrom(tcpConn, r)
+			w.bodyBytes += n
+			return n, err
+		}
+	}
+	buf := make([]byte, copyBufferSize)
+	return io.CopyBuffer(bodyWriter{w}, r, buf)
+}
+
+// bodyWriter writes through the Writer's body methods while hiding ReadFrom, so io.CopyBuffer does not recurse.
+type bodyWriter struct {
+	w *Writer
+}
+
+func (bw bodyWriter) Write(p []byte) (int, error) {
+	return bw.w.WriteBody(p)
+}
@@ -0,0 +1,140 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFrom(t *testing.T) {
+	var fastPath []io.Reader
+	tcpReadFrom = func(c *net.TCPConn, r io.Reader) (int64, error) {
+		fastPath = append(fastPath, r)
+		return c.ReadFrom(r)
+	}
+	t.Cleanup(func() { tcpReadFrom = (*net.TCPConn).ReadFrom })
+
+	// Test: Plain body over a TCP connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	name := filepath.Join(t.TempDir(), "body.txt")
+	content := strings.Repeat("sendfile ", 10000)
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	w := NewWriter(conn)
+	n, err := io.Copy(w, f)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	conn.Close()
+	assert.Equal(t, content, string(<-received))
+
+	// Test: The copy went through the connection's ReadFrom with a reader that still exposes the file
+	// descriptor (io.Copy hands over the *os.File behind a wrapper hiding WriteTo), so it can use sendfile
+	require.Len(t, fastPath, 1)
+	assert.Implements(t, (*syscall.Conn)(nil), fastPath[0])
+
+	// Test: A writer that is not the TCP connection itself takes the buffered copy
+	fastPath = nil
+	w = NewWriter(conn)
+	w.W = struct{ io.Writer }{io.Discard}
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	n, err = io.Copy(w, f)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Empty(t, fastPath)
+
+	// Test: Chunked output is framed
+	var buf bytes.Buffer
+	w = &Writer{W: &buf}
+	h := GetDefaultHeaders(0)
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	buf.Reset()
+	n, err = w.ReadFrom(strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, "5\r\nhello\r\n", buf.String())
+}
+
+func benchmarkReadFrom(b *testing.B, wrap bool) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	name := filepath.Join(b.TempDir(), "video.bin")
+	size := 8 << 20
+	require.NoError(b, os.WriteFile(name, bytes.Repeat([]byte{0xab}, size), 0o644))
+	f, err := os.Open(name)
+	require.NoError(b, err)
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(b, err)
+	defer conn.Close()
+
+	w := NewWriter(conn)
+	if wrap {
+		// hide the *net.TCPConn so the buffered fallback is used
+		w.W = struct{ io.Writer }{conn}
+	}
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for range b.N {
+		_, err := f.Seek(0, io.SeekStart)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = w.ReadFrom(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadFromSendfile(b *testing.B) {
+	benchmarkReadFrom(b, false)
+}
+
+func BenchmarkReadFromBuffered(b *testing.B) {
+	benchmarkReadFrom(b, true)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// requestContext is the context of one request. It ends when the client disconnects, the server shuts down,
+// RequestTimeout runs out or the handler returns. Once the connection is hijacked only shutdown still applies,
+// and only while the handler runs: the connection, and with it the context, belong to the hijacker.
+type requestContext struct {
+	// values come from the server's context, but not its cancellation, which is tracked through stopParent
+	context.Context
+
+	done       chan struct{}
+	stopParent func() bool
+
+	mu       sync.Mutex
+	err      error
+	deadline time.Time
+	timer    *time.Timer
+	hijacked bool
+}
+
+func newRequestContext(parent context.Context, timeout time.Duration) *requestContext {
+	c := &requestContext{
+		Context: context.WithoutCancel(parent),
+		done:    make(chan struct{}),
+	}
+	if timeout > 0 {
+		c.deadline = time.Now().Add(timeout)
+		c.timer = time.AfterFunc(timeout, func() { c.cancel(context.DeadlineExceeded) })
+	}
+	c.stopParent = context.AfterFunc(parent, func() { c.cancel(parent.Err()) })
+	return c
+}
+
+func (c *requestContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, !c.deadline.IsZero()
+}
+
+func (c *requestContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *requestContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *requestContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// hijack drops the request timeout: hijacked connections get no server timeouts.
+func (c *requestContext) hijack() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hijacked = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.deadline = time.Time{}
+}
+
+// finish is called when the handler returns. The context of a hijacked connection is left alone,
+// since the hijacker may still be using it.
+func (c *requestContext) finish() {
+	c.stopParent()
+	c.mu.Lock()
+	hijacked := c.hijacked
+	c.mu.Unlock()
+	if !hijacked {
+		c.cancel(context.Canceled)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/metrics"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// serverMetrics are the metrics the server records about itself. A nil *serverMetrics records nothing.
+type serverMetrics struct {
+	requests     *metrics.Counter
+	duration     *metrics.Histogram
+	requestSize  *metrics.Histogram
+	responseSize *metrics.Histogram
+	connections  *metrics.Gauge
+	acceptErrors *metrics.Counter
+	parseErrors  *metrics.Counter
+}
+
+func newServerMetrics(r *metrics.Registry) *serverMetrics {
+	m := &serverMetrics{
+		requests: r.NewCounter("http_requests_total",
+			"Requests handled, by method and status code.", "method", "status"),
+		duration: r.NewHistogram("http_request_duration_seconds",
+			"Time spent in the handler.", metrics.DefaultDurationBuckets, "method"),
+		requestSize: r.NewHistogram("http_request_size_bytes",
+			"Size of request bodies.", metrics.DefaultSizeBuckets),
+		responseSize: r.NewHistogram("http_response_size_bytes",
+			"Size of response bodies as sent.", metrics.DefaultSizeBuckets),
+		connections: r.NewGauge("http_connections",
+			"Open connections; idle ones are waiting for a request, active ones are being handled, "+
+				"hijacked ones have been handed over to a handler.", "state"),
+		acceptErrors: r.NewCounter("http_accept_errors_total",
+			"Errors accepting new connections."),
+		parseErrors: r.NewCounter("http_request_parse_errors_total",
+			"Requests rejected because they could not be parsed."),
+	}
+	m.connections.Set(0, "idle")
+	m.connections.Set(0, "active")
+	m.connections.Set(0, "hijacked")
+	return m
+}
+
+func (m *serverMetrics) connOpened() {
+	if m != nil {
+		m.connections.Inc("idle")
+	}
+}
+
+// connActive moves a connection from idle to active once its request has been read.
+func (m *serverMetrics) connActive() {
+	if m != nil {
+		m.connections.Dec("idle")
+		m.connections.Inc("active")
+	}
+}
+
+// connHijacked moves a connection from active to hijacked, where it stays until the hijacker closes it.
+func (m *serverMetrics) connHijacked() {
+	if m != nil {
+		m.connections.Dec("active")
+		m.connections.Inc("hijacked")
+	}
+}
+
+func (m *serverMetrics) hijackedClosed() {
+	if m != nil {
+		m.connections.Dec("hijacked")
+	}
+}
+
+func (m *serverMetrics) connClosed(active bool) {
+	if m == nil {
+		return
+	}
+	if active {
+		m.connections.Dec("active")
+	} else {
+		m.connections.Dec("idle")
+	}
+}
+
+func (m *serverMetrics) acceptError() {
+	if m != nil {
+		m.acceptErrors.Inc()
+	}
+}
+
+func (m *serverMetrics) parseError() {
+	if m != nil {
+		m.parseErrors.Inc()
+	}
+}
+
+func (m *serverMetrics) observe(req *request.Request, w *response.Writer, d time.Duration) {
+	if m == nil {
+		return
+	}
+	method := methodLabel(req.RequestLine.Method)
+	m.requests.Inc(method, strconv.Itoa(int(w.StatusCode())))
+	m.duration.Observe(d.Seconds(), method)
+	m.requestSize.Observe(float64(len(req.Body)))
+	m.responseSize.Observe(float64(w.BytesWritten()))
+}
+
+// methodLabel keeps the method label to a fixed set of values; clients can send any method they like,
+// and each distinct one would otherwise become a new time series.
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+// metricsRoute serves the registry at path and passes everything else to next.
+func metricsRoute(path string, r *metrics.Registry, next Handler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if req.Path() == path {
+			r.Handle(w, req)
+			return
+		}
+		next(w, req)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/metrics"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	addr := startServer(t, Config{
+		Metrics: reg,
+		Handler: func(w *response.Writer, req *request.Request) {
+			if req.Path() == "/slow" {
+				close(entered)
+				<-release
+			}
+			if req.Path() == "/hijack" {
+				conn, _, err := w.Hijack()
+				if assert.NoError(t, err) {
+					go func() {
+						<-release
+						conn.Close()
+					}()
+				}
+				return
+			}
+			w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+		},
+	})
+	text := func() string {
+		var sb strings.Builder
+		require.NoError(t, reg.WriteText(&sb))
+		return sb.String()
+	}
+
+	// Test: Served requests are counted and timed
+	send(t, addr, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send(t, addr, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc")
+	out := text()
+	assert.Contains(t, out, "http_requests_total{method=\"GET\",status=\"200\"} 1\n")
+	assert.Contains(t, out, "http_requests_total{method=\"POST\",status=\"200\"} 1\n")
+	assert.Contains(t, out, "http_request_duration_seconds_count{method=\"GET\"} 1\n")
+	assert.Contains(t, out, "http_request_size_bytes_sum 3\n")
+
+	// Test: Unknown methods share one label value
+	send(t, addr, "BREW / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	send(t, addr, "WHEN / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	out = text()
+	assert.Contains(t, out, "http_requests_total{method=\"OTHER\",status=\"200\"} 2\n")
+	assert.NotContains(t, out, "BREW")
+
+	// Test: Parse errors
+	send(t, addr, "garbage\r\n\r\n")
+	assert.Contains(t, text(), "http_request_parse_errors_total 1\n")
+
+	// Test: Connections are active while handled and gone once closed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		send(t, addr, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	}()
+	<-entered
+	assert.Contains(t, text(), "http_connections{state=\"active\"} 1\n")
+	close(release)
+	<-done
+	assert.Eventually(t, func() bool {
+		out := text()
+		return strings.Contains(out, "http_connections{state=\"active\"} 0\n") &&
+			strings.Contains(out, "http_connections{state=\"idle\"} 0\n")
+	}, time.Second, 5*time.Millisecond)
+
+	// Test: Hijacked connections are counted apart from active ones until the hijacker closes them
+	release = make(chan struct{})
+	conn := dial(t, addr, "GET /hijack HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Eventually(t, func() bool {
+		out := text()
+		return strings.Contains(out, "http_connections{state=\"hijacked\"} 1\n") &&
+			strings.Contains(out, "http_connections{state=\"active\"} 0\n")
+	}, time.Second, 5*time.Millisecond)
+	close(release)
+	_, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, text(), "http_connections{state=\"hijacked\"} 0\n")
+
+	// Test: The registry is served at the default path
+	resp, _ := send(t, addr, "GET /metrics HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, resp, "http_requests_total{method=\"GET\",status=\"200\"} 2\n")
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/lordvorath/httpfromtcp/internal/metrics"
 	"github.com/lordvorath/httpfromtcp/internal/request"
 	"github.com/lordvorath/httpfromtcp/internal/response"
 )
@@ -14,7 +19,27 @@ type Server struct {
 	port          int
 	listener      net.Listener
 	handler       Handler
+	logger        *slog.Logger
+	metrics       *serverMetrics
 	serverRunning atomic.Bool
+	nextConnID    atomic.Uint64
+
+	requestTimeout time.Duration
+	ctx            context.Context
+	cancel         context.CancelFunc
+}
+
+type Config struct {
+	Port    int
+	Handler Handler
+	// Logger receives the server's own diagnostics. Nil discards them.
+	Logger *slog.Logger
+	// Metrics, when set, receives the server's metrics and is served at MetricsPath ("/metrics" by default).
+	Metrics     *metrics.Registry
+	MetricsPath string
+	// RequestTimeout, when set, is the deadline of each request's context. It is lifted when the
+	// connection is hijacked.
+	RequestTimeout time.Duration
 }
 
 type HandlerError struct {
@@ -24,17 +49,50 @@ type HandlerError struct {
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// Middleware wraps a Handler with extra behaviour.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h so that the first middleware is the outermost one.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 func Serve(port int, handler Handler) (*Server, error) {
-	addr := fmt.Sprintf(":%d", port)
+	return ServeConfig(Config{Port: port, Handler: handler})
+}
+
+func ServeConfig(cfg Config) (*Server, error) {
+	addr := fmt.Sprintf(":%d", cfg.Port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make listener: %v", err)
 	}
 
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	s := Server{
-		port:     port,
-		listener: listener,
-		handler:  handler,
+		port:           cfg.Port,
+		listener:       listener,
+		handler:        cfg.Handler,
+		logger:         logger,
+		requestTimeout: cfg.RequestTimeout,
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+	if cfg.Metrics != nil {
+		path := cfg.MetricsPath
+		if path == "" {
+			path = defaultMetricsPath
+		}
+		s.metrics = newServerMetrics(cfg.Metrics)
+		s.handler = metricsRoute(path, cfg.Metrics, s.handler)
 	}
 	s.serverRunning.Store(true)
 
@@ -43,8 +101,10 @@ func Serve(port int, handler Handler) (*Server, error) {
 	return &s, nil
 }
 
+// Close stops accepting connections and cancels the contexts of requests in flight.
 func (s *Server) Close() error {
 	s.serverRunning.Store(false)
+	s.cancel()
 	err := s.listener.Close()
 	if err != nil {
 		return fmt.Errorf("failed to close listener: %v", err)
@@ -56,7 +116,12 @@ func (s *Server) listen() {
 	for s.serverRunning.Load() {
 		netConn, err := s.listener.Accept()
 		if err != nil {
-			fmt.Printf("failed to establish connection: %v\n", err)
+			if !s.serverRunning.Load() {
+				return
+			}
+			s.logger.Error("failed to accept connection", "error", err)
+			s.metrics.acceptError()
+			continue
 		}
 
 		go s.handle(netConn)
@@ -65,24 +130,73 @@ func (s *Server) listen() {
 }
 
 func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+	logger := s.logger.With("conn_id", s.nextConnID.Add(1), "remote_addr", conn.RemoteAddr().String())
+	logger.Debug("connection opened")
+	s.metrics.connOpened()
 
 	req, err := request.RequestFromReader(conn)
 	if err != nil {
+		logger.Debug("malformed request", "error", err)
+		s.metrics.parseError()
+		defer s.metrics.connClosed(false)
 		he := &HandlerError{
 			StatusCode: int(response.StatusBadRequest),
 			Message:    err.Error(),
 		}
-		he.Write(conn)
+		err = he.Write(conn)
+		if err != nil {
+			logger.Debug("failed to write error response", "error", err)
+		}
 		return
 	}
 
-	writer := response.Writer{
-		W: conn,
+	req.RemoteAddr = conn.RemoteAddr().String()
+
+	ctx := newRequestContext(s.ctx, s.requestTimeout)
+	defer ctx.finish()
+	req = req.WithContext(ctx)
+	watcher := watchConn(conn, func() { ctx.cancel(context.Canceled) })
+
+	// the hijacker gets a conn that reports its closing, while responses are still written
+	// to conn itself so that sendfile can see the TCP connection
+	writer := response.NewWriter(&hijackedConn{Conn: conn, onClose: s.metrics.hijackedClosed})
+	writer.W = conn
+	writer.SetBuffered(req.Buffered())
+	writer.SetLogger(logger)
+	writer.OnHijack(func() []byte {
+		ctx.hijack()
+		s.metrics.connHijacked()
+		return watcher.stop()
+	})
+	// however the handler ends, the connection is closed unless it was handed to a hijacker
+	defer func() {
+		watcher.stop()
+		if writer.Hijacked() {
+			return
+		}
+		conn.Close()
+		logger.Debug("connection closed")
+	}()
+
+	s.metrics.connActive()
+	defer func() {
+		if !writer.Hijacked() {
+			s.metrics.connClosed(true)
+		}
+	}()
+	start := time.Now()
+	s.handler(writer, req)
+	s.metrics.observe(req, writer, time.Since(start))
+	watcher.stop()
+
+	if writer.Hijacked() {
+		logger.Debug("connection hijacked")
+		return
+	}
+	err = writer.Close()
+	if err != nil {
+		logger.Debug("failed to finish response", "error", err)
 	}
-
-	s.handler(&writer, req)
-
 }
 
 func (he HandlerError) Write(conn net.Conn) error {
@@ -107,3 +221,15 @@ func (he HandlerError) Write(conn net.Conn) error {
 	}
 	return nil
 }
+
+// hijackedConn is the connection handed out by Hijack. onClose runs the first time it is closed.
+type hijackedConn struct {
+	net.Conn
+	onClose   func()
+	closeOnce sync.Once
+}
+
+func (c *hijackedConn) Close() error {
+	c.closeOnce.Do(c.onClose)
+	return c.Conn.Close()
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves cfg on a free port and returns the address to dial.
+func startServer(t *testing.T, cfg Config) string {
+	_, addr := startServerWithHandle(t, cfg)
+	return addr
+}
+
+func startServerWithHandle(t *testing.T, cfg Config) (*Server, string) {
+	cfg.Port = 0
+	s, err := ServeConfig(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, s.listener.Addr().String()
+}
+
+func dial(t *testing.T, addr, raw string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+	return conn
+}
+
+// waitDone waits for ctx to end and returns its error, or nil if that takes too long.
+func waitDone(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		return nil
+	}
+}
+
+// send writes raw to a new connection and returns everything the server sends back before closing it.
+func send(t *testing.T, addr, raw string) (string, string) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(raw))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(resp), conn.LocalAddr().String()
+}
+
+type logRecord struct {
+	level slog.Level
+	msg   string
+	attrs map[string]any
+}
+
+// captureHandler is a slog.Handler that keeps every record, with the attributes added through With.
+type captureHandler struct {
+	mu      *sync.Mutex
+	records *[]logRecord
+	attrs   []slog.Attr
+}
+
+func newCaptureHandler() *captureHandler {
+	return &captureHandler{mu: &sync.Mutex{}, records: &[]logRecord{}}
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := logRecord{level: r.Level, msg: r.Message, attrs: map[string]any{}}
+	for _, a := range h.attrs {
+		rec.attrs[a.Key] = a.Value.Any()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		rec.attrs[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.records = append(*h.records, rec)
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &captureHandler{mu: h.mu, records: h.records, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the first record with msg.
+func (h *captureHandler) find(msg string) (logRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.records {
+		if r.msg == msg {
+			return r, true
+		}
+	}
+	return logRecord{}, false
+}
+
+func TestLogger(t *testing.T) {
+	logs := newCaptureHandler()
+	addr := startServer(t, Config{
+		Logger: slog.New(logs),
+		Handler: func(w *response.Writer, req *request.Request) {
+			w.Logger().Info("handled", "path", req.Path())
+			w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+		},
+	})
+
+	// Test: Handlers log through the writer with the connection's attributes
+	_, local := send(t, addr, "GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	rec, ok := logs.find("handled")
+	require.True(t, ok)
+	assert.Equal(t, slog.LevelInfo, rec.level)
+	assert.Equal(t, "/a", rec.attrs["path"])
+	assert.Equal(t, uint64(1), rec.attrs["conn_id"])
+	assert.Equal(t, local, rec.attrs["remote_addr"])
+	assert.Eventually(t, func() bool {
+		_, ok := logs.find("connection closed")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	// Test: Parse errors are logged on the server's logger, for the connection they happened on
+	resp, local := send(t, addr, "garbage\r\n\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 400 Bad Request\r\n")
+	rec, ok = logs.find("malformed request")
+	require.True(t, ok)
+	assert.Equal(t, slog.LevelDebug, rec.level)
+	assert.Equal(t, uint64(2), rec.attrs["conn_id"])
+	assert.Equal(t, local, rec.attrs["remote_addr"])
+	assert.NotEmpty(t, rec.attrs["error"])
+
+	// Test: Without a logger nothing is logged, and nothing breaks
+	addr = startServer(t, Config{Handler: func(w *response.Writer, req *request.Request) {
+		w.Logger().Info("handled")
+		w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+	}})
+	resp, _ = send(t, addr, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, resp, "HTTP/1.1 200 OK\r\n")
+}
+
+func TestRequestContext(t *testing.T) {
+	const get = "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
+	errs := make(chan error, 1)
+	waitHandler := func(w *response.Writer, req *request.Request) {
+		errs <- waitDone(req.Context())
+	}
+
+	// Test: The client disconnecting cancels the context
+	addr := startServer(t, Config{Handler: waitHandler})
+	conn := dial(t, addr, get)
+	conn.Close()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	// Test: Shutting the server down cancels handlers in flight
+	s, addr := startServerWithHandle(t, Config{Handler: waitHandler})
+	dial(t, addr, get)
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	// Test: RequestTimeout is the context's deadline
+	addr = startServer(t, Config{RequestTimeout: 50 * time.Millisecond, Handler: func(w *response.Writer, req *request.Request) {
+		deadline, ok := req.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 40*time.Millisecond)
+		waitHandler(w, req)
+	}})
+	start := time.Now()
+	dial(t, addr, get)
+	assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// Test: A context derived from the request's is cancelled with it
+	addr = startServer(t, Config{Handler: func(w *response.Writer, req *request.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		errs <- waitDone(ctx)
+	}})
+	dial(t, addr, get).Close()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+}
+
+func TestHijack(t *testing.T) {
+	sent := make(chan struct{})
+	ctxs := make(chan context.Context, 1)
+	addr := startServer(t, Config{RequestTimeout: 200 * time.Millisecond, Handler: func(w *response.Writer, req *request.Request) {
+		// by now the watcher has read ahead into whatever the client sent after the request
+		<-sent
+		time.Sleep(20 * time.Millisecond)
+		conn, buffered, err := w.Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		assert.NotEmpty(t, buffered)
+		data := make([]byte, 4)
+		n := copy(data, buffered)
+		_, err = io.ReadFull(conn, data[n:])
+		assert.NoError(t, err)
+		conn.Write(append([]byte("got "), data...))
+
+		// Test: Hijacked connections get no request timeout
+		_, ok := req.Context().Deadline()
+		assert.False(t, ok)
+		time.Sleep(250 * time.Millisecond)
+		assert.NoError(t, req.Context().Err())
+		ctxs <- req.Context()
+	}})
+
+	// Test: Bytes read ahead by the parser and by the connection watcher both reach the hijacker,
+	// for a pipelined request as much as for data sent after the request
+	for _, tc := range []struct{ withRequest, after string }{
+		{"PI", "NG"},
+		{"", "PING"},
+	} {
+		conn := dial(t, addr, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"+tc.withRequest)
+		time.Sleep(20 * time.Millisecond)
+		_, err := conn.Write([]byte(tc.after))
+		require.NoError(t, err)
+		sent <- struct{}{}
+		resp, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		assert.Equal(t, "got PING", string(resp))
+
+		// Test: The context outlives the handler of a hijacked connection
+		ctx := <-ctxs
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, ctx.Err())
+	}
+}
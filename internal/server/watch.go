@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connWatcher reads from a connection while its request is being handled so that the request's
+// context can be cancelled as soon as the client disconnects.
+type connWatcher struct {
+	conn     net.Conn
+	stopping atomic.Bool
+	done     chan struct{}
+	once     sync.Once
+	extra    []byte
+}
+
+func watchConn(conn net.Conn, cancel context.CancelFunc) *connWatcher {
+	cw := &connWatcher{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(cw.done)
+		var b [1]byte
+		n, err := conn.Read(b[:])
+		if n > 0 {
+			// the client is sending more data, e.g. after an upgrade; keep it for whoever hijacks
+			cw.extra = b[:n]
+			return
+		}
+		if err != nil && !cw.stopping.Load() {
+			cancel()
+		}
+	}()
+	return cw
+}
+
+// stop ends the background read and returns any byte it consumed.
+func (cw *connWatcher) stop() []byte {
+	cw.once.Do(func() {
+		cw.stopping.Store(true)
+		cw.conn.SetReadDeadline(time.Now())
+		<-cw.done
+		cw.conn.SetReadDeadline(time.Time{})
+	})
+	return cw.extra
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxCookieSize is the largest encoded cookie value browsers are guaranteed to keep.
+const maxCookieSize = 4000
+
+var (
+	errInvalidCookie  = errors.New("invalid session cookie")
+	errCookieTooLarge = errors.New("session cookie too large")
+)
+
+// Key signs and optionally encrypts session cookies.
+type Key struct {
+	// Hash is the HMAC-SHA256 key. Use at least 32 random bytes.
+	Hash []byte
+	// Block turns on AES-GCM encryption when set. It must be 16, 24 or 32 bytes long.
+	Block []byte
+}
+
+func (k Key) validate() error {
+	if len(k.Hash) == 0 {
+		return errors.New("session key has no hash key")
+	}
+	switch len(k.Block) {
+	case 0, 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("invalid AES key size %d", len(k.Block))
+}
+
+// encode encrypts (if the key has a block key) and signs payload, binding it to the cookie name.
+// The result is "base64(payload).base64(mac)".
+func encode(key Key, name string, payload []byte) (string, error) {
+	if len(key.Block) > 0 {
+		gcm, err := newGCM(key.Block)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return "", err
+		}
+		payload = gcm.Seal(nonce, nonce, payload, []byte(name))
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString(payload)
+	mac := base64.RawURLEncoding.EncodeToString(sign(key.Hash, name, b64))
+	value := b64 + "." + mac
+	if len(value) > maxCookieSize {
+		return "", errCookieTooLarge
+	}
+	return value, nil
+}
+
+// decode verifies value against each key in turn and returns the payload and the index of the key that matched.
+func decode(keys []Key, name, value string) ([]byte, int, error) {
+	b64, macB64, found := strings.Cut(value, ".")
+	if !found {
+		return nil, 0, errInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(macB64)
+	if err != nil {
+		return nil, 0, errInvalidCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, 0, errInvalidCookie
+	}
+
+	for i, key := range keys {
+		if !hmac.Equal(mac, sign(key.Hash, name, b64)) {
+			continue
+		}
+		if len(key.Block) == 0 {
+			return payload, i, nil
+		}
+		gcm, err := newGCM(key.Block)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(payload) < gcm.NonceSize() {
+			return nil, 0, errInvalidCookie
+		}
+		nonce, ciphertext := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+		plain, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil {
+			return nil, 0, errInvalidCookie
+		}
+		return plain, i, nil
+	}
+	return nil, 0, errInvalidCookie
+}
+
+func sign(hashKey []byte, name, b64 string) []byte {
+	m := hmac.New(sha256.New, hashKey)
+	m.Write([]byte(name + "|" + b64))
+	return m.Sum(nil)
+}
+
+func newGCM(blockKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(blockKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newID returns a random, URL and filename safe session ID.
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func validID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+const (
+	defaultCookieName = "session"
+	defaultMaxAge     = 24 * time.Hour
+)
+
+type Options struct {
+	// Keys sign and encrypt cookies. The first key is used for new cookies, the others are only
+	// accepted, so keys can be rotated by prepending a new one.
+	Keys []Key
+	// Store keeps the session data on the server. When nil the data travels in the cookie itself.
+	Store Store
+
+	CookieName string
+	MaxAge     time.Duration
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   headers.SameSite
+}
+
+type Manager struct {
+	opts Options
+}
+
+// contextKey is per manager, so several managers with different cookies can be stacked.
+type contextKey struct {
+	m *Manager
+}
+
+func New(opts Options) (*Manager, error) {
+	if len(opts.Keys) == 0 {
+		return nil, errors.New("no session keys")
+	}
+	for _, k := range opts.Keys {
+		err := k.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = defaultCookieName
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = defaultMaxAge
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	return &Manager{opts: opts}, nil
+}
+
+// Session holds the values of one client's session. Changes are saved when the response headers are written,
+// so they must be made before the handler starts writing the response.
+type Session struct {
+	ID      string
+	Values  map[string]string
+	Expires time.Time
+
+	isNew      bool
+	changed    bool
+	destroyed  bool
+	previousID string
+}
+
+func (s *Session) Get(key string) string {
+	return s.Values[key]
+}
+
+func (s *Session) Set(key, val string) {
+	s.Values[key] = val
+	s.changed = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+	s.changed = true
+}
+
+// Destroy clears the session and tells the client to drop its cookie.
+func (s *Session) Destroy() {
+	clear(s.Values)
+	s.destroyed = true
+}
+
+func (s *Session) regenerate(maxAge time.Duration) {
+	if s.previousID == "" && !s.isNew {
+		s.previousID = s.ID
+	}
+	s.ID = newID()
+	s.Expires = time.Now().Add(maxAge).Truncate(time.Second)
+	s.changed = true
+}
+
+// cookieData is what gets encoded into the cookie: the ID when there is a store, the values otherwise.
+type cookieData struct {
+	ID      string            `json:"id,omitempty"`
+	Values  map[string]string `json:"v,omitempty"`
+	Expires int64             `json:"e"`
+}
+
+// Get returns the session of a request passing through Middleware, or nil.
+func (m *Manager) Get(req *request.Request) *Session {
+	s, _ := req.Context().Value(contextKey{m}).(*Session)
+	return s
+}
+
+// Regenerate moves the request's session to a new ID with a fresh expiry, keeping its values.
+// Call it whenever the privilege level changes, e.g. on login, to prevent session fixation.
+func (m *Manager) Regenerate(req *request.Request) {
+	if s := m.Get(req); s != nil {
+		s.regenerate(m.opts.MaxAge)
+	}
+}
+
+// Middleware loads the session before calling next and saves it right before the response headers are sent.
+func (m *Manager) Middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		s := m.load(req)
+		req = req.WithContext(context.WithValue(req.Context(), contextKey{m}, s))
+
+		w.AddFilter(func(_ response.StatusCode, _ headers.Headers) func(io.Writer) io.WriteCloser {
+			err := m.save(w, s)
+			if err != nil {
+				w.Logger().Warn("failed to save session", "error", err)
+			}
+			return nil
+		})
+		next(w, req)
+	}
+}
+
+func (m *Manager) load(req *request.Request) *Session {
+	fresh := &Session{
+		ID:      newID(),
+		Values:  map[string]string{},
+		Expires: time.Now().Add(m.opts.MaxAge).Truncate(time.Second),
+		isNew:   true,
+	}
+
+	value, ok := req.Cookie(m.opts.CookieName)
+	if !ok {
+		return fresh
+	}
+	payload, keyIndex, err := decode(m.opts.Keys, m.opts.CookieName, value)
+	if err != nil {
+		return fresh
+	}
+	var data cookieData
+	err = json.Unmarshal(payload, &data)
+	if err != nil || time.Now().After(time.Unix(data.Expires, 0)) {
+		return fresh
+	}
+
+	s := &Session{
+		ID:      data.ID,
+		Values:  data.Values,
+		Expires: time.Unix(data.Expires, 0),
+		// re-sign cookies made with an old key
+		changed: keyIndex != 0,
+	}
+	if m.opts.Store != nil {
+		s.Values, s.Expires, err = m.opts.Store.Load(data.ID)
+		if err != nil {
+			return fresh
+		}
+	}
+	if s.Values == nil {
+		s.Values = map[string]string{}
+	}
+	return s
+}
+
+func (m *Manager) save(w *response.Writer, s *Session) error {
+	store := m.opts.Store
+	if s.destroyed {
+		if store != nil && !s.isNew {
+			store.Delete(s.ID)
+		}
+		if s.isNew {
+			return nil
+		}
+		return w.SetCookie(m.cookie("", -1))
+	}
+	if !s.changed || (s.isNew && len(s.Values) == 0) {
+		return nil
+	}
+
+	data := cookieData{Expires: s.Expires.Unix()}
+	if store != nil {
+		if s.previousID != "" {
+			store.Delete(s.previousID)
+		}
+		err := store.Save(s.ID, s.Values, s.Expires)
+		if err != nil {
+			return err
+		}
+		data.ID = s.ID
+	} else {
+		data.Values = s.Values
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	value, err := encode(m.opts.Keys[0], m.opts.CookieName, payload)
+	if err != nil {
+		return err
+	}
+	c := m.cookie(value, int(time.Until(s.Expires).Seconds()))
+	c.Expires = s.Expires
+	return w.SetCookie(c)
+}
+
+func (m *Manager) cookie(value string, maxAge int) *headers.Cookie {
+	if maxAge == 0 {
+		maxAge = -1
+	}
+	return &headers.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    value,
+		Path:     m.opts.Path,
+		Domain:   m.opts.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.opts.Secure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	}
+}
@@ -0,0 +1,195 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	hashKey  = bytes.Repeat([]byte{1}, 32)
+	blockKey = bytes.Repeat([]byte{2}, 32)
+)
+
+// roundTrip runs one request through the middleware and returns the Set-Cookie values it produced.
+func roundTrip(t *testing.T, m *Manager, cookie string, handle func(req *request.Request)) []string {
+	reqText := "GET / HTTP/1.1\r\nHost: localhost\r\n"
+	if cookie != "" {
+		reqText += "Cookie: " + cookie + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(reqText + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := &response.Writer{W: &buf}
+	m.Middleware(func(w *response.Writer, req *request.Request) {
+		handle(req)
+		w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+	})(w, req)
+
+	resp, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	return resp.Header.Values("Set-Cookie")
+}
+
+// cookiePair turns a Set-Cookie value into a Cookie request header value.
+func cookiePair(setCookie string) string {
+	pair, _, _ := strings.Cut(setCookie, ";")
+	return pair
+}
+
+// tamper flips a bit in the MAC of a session cookie pair. Changing the last base64 character instead
+// isn't enough, as its low bits are padding the decoder ignores.
+func tamper(t *testing.T, cookie string) string {
+	i := strings.LastIndex(cookie, ".")
+	require.NotEqual(t, -1, i)
+	mac, err := base64.RawURLEncoding.DecodeString(cookie[i+1:])
+	require.NoError(t, err)
+	mac[0] ^= 1
+	return cookie[:i+1] + base64.RawURLEncoding.EncodeToString(mac)
+}
+
+func TestCookieSessions(t *testing.T) {
+	for _, key := range []Key{{Hash: hashKey}, {Hash: hashKey, Block: blockKey}} {
+		m, err := New(Options{Keys: []Key{key}})
+		require.NoError(t, err)
+
+		// Test: Untouched new session sets no cookie
+		set := roundTrip(t, m, "", func(req *request.Request) {
+			assert.Equal(t, "", m.Get(req).Get("user"))
+		})
+		assert.Empty(t, set)
+
+		// Test: Values survive a round trip
+		set = roundTrip(t, m, "", func(req *request.Request) {
+			m.Get(req).Set("user", "alice")
+		})
+		require.Len(t, set, 1)
+		assert.Contains(t, set[0], "HttpOnly")
+		cookie := cookiePair(set[0])
+		roundTrip(t, m, cookie, func(req *request.Request) {
+			assert.Equal(t, "alice", m.Get(req).Get("user"))
+		})
+		if len(key.Block) > 0 {
+			assert.NotContains(t, cookie, "alice")
+		}
+
+		// Test: Tampered cookies start a fresh session
+		roundTrip(t, m, tamper(t, cookie), func(req *request.Request) {
+			assert.Equal(t, "", m.Get(req).Get("user"))
+		})
+
+		// Test: Destroy expires the cookie
+		set = roundTrip(t, m, cookie, func(req *request.Request) {
+			m.Get(req).Destroy()
+		})
+		require.Len(t, set, 1)
+		assert.Contains(t, set[0], "Max-Age=0")
+	}
+}
+
+func TestSaveErrors(t *testing.T) {
+	m, err := New(Options{Keys: []Key{{Hash: hashKey}}})
+	require.NoError(t, err)
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: A session that can't be saved is reported to the response's logger, and the response still goes out
+	var logs, buf bytes.Buffer
+	w := &response.Writer{W: &buf}
+	w.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+	m.Middleware(func(w *response.Writer, req *request.Request) {
+		m.Get(req).Set("big", strings.Repeat("x", maxCookieSize))
+		w.WriteResponse(response.StatusOk, nil, []byte("ok"))
+	})(w, req)
+
+	assert.Contains(t, logs.String(), `level=WARN msg="failed to save session" error="session cookie too large"`)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, buf.String(), "set-cookie")
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := Key{Hash: hashKey, Block: blockKey}
+	m, err := New(Options{Keys: []Key{old}})
+	require.NoError(t, err)
+	set := roundTrip(t, m, "", func(req *request.Request) {
+		m.Get(req).Set("user", "bob")
+	})
+	cookie := cookiePair(set[0])
+
+	// Test: Cookies signed with an old key are accepted and re-signed with the new one
+	rotated, err := New(Options{Keys: []Key{{Hash: bytes.Repeat([]byte{3}, 32)}, old}})
+	require.NoError(t, err)
+	set = roundTrip(t, rotated, cookie, func(req *request.Request) {
+		assert.Equal(t, "bob", rotated.Get(req).Get("user"))
+	})
+	require.Len(t, set, 1)
+	assert.NotEqual(t, cookie, cookiePair(set[0]))
+
+	// Test: Once the old key is dropped the cookie is rejected
+	dropped, err := New(Options{Keys: []Key{{Hash: bytes.Repeat([]byte{3}, 32)}}})
+	require.NoError(t, err)
+	roundTrip(t, dropped, cookie, func(req *request.Request) {
+		assert.Equal(t, "", dropped.Get(req).Get("user"))
+	})
+
+	// Test: Invalid keys
+	_, err = New(Options{})
+	assert.Error(t, err)
+	_, err = New(Options{Keys: []Key{{Hash: hashKey, Block: []byte("short")}}})
+	assert.Error(t, err)
+}
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, store := range []Store{NewMemoryStore(), fileStore} {
+		m, err := New(Options{Keys: []Key{{Hash: hashKey}}, Store: store})
+		require.NoError(t, err)
+
+		// Test: Only the ID travels in the cookie
+		var id string
+		set := roundTrip(t, m, "", func(req *request.Request) {
+			m.Get(req).Set("user", "carol")
+			id = m.Get(req).ID
+		})
+		cookie := cookiePair(set[0])
+		values, _, err := store.Load(id)
+		require.NoError(t, err)
+		assert.Equal(t, "carol", values["user"])
+
+		// Test: Regenerate moves the data to a new ID
+		var newID string
+		set = roundTrip(t, m, cookie, func(req *request.Request) {
+			assert.Equal(t, "carol", m.Get(req).Get("user"))
+			m.Regenerate(req)
+			newID = m.Get(req).ID
+		})
+		assert.NotEqual(t, id, newID)
+		_, _, err = store.Load(id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		roundTrip(t, m, cookiePair(set[0]), func(req *request.Request) {
+			assert.Equal(t, "carol", m.Get(req).Get("user"))
+		})
+
+		// Test: Expired sessions are gone
+		require.NoError(t, store.Save(id, map[string]string{"a": "b"}, time.Now().Add(-time.Second)))
+		_, _, err = store.Load(id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	// Test: File store refuses IDs that aren't ours
+	_, _, err = fileStore.Load("../../etc/passwd")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
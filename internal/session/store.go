@@ -0,0 +1,181 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps session data on the server side, so the cookie only carries the session ID.
+type Store interface {
+	// Load returns ErrNotFound for unknown or expired sessions.
+	Load(id string) (map[string]string, time.Time, error)
+	Save(id string, values map[string]string, expires time.Time) error
+	Delete(id string) error
+}
+
+type record struct {
+	Values  map[string]string `json:"values"`
+	Expires time.Time         `json:"expires"`
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]record{}}
+}
+
+func (s *MemoryStore) Load(id string) (map[string]string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.sessions[id]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if time.Now().After(rec.Expires) {
+		delete(s.sessions, id)
+		return nil, time.Time{}, ErrNotFound
+	}
+	return maps.Clone(rec.Values), rec.Expires, nil
+}
+
+func (s *MemoryStore) Save(id string, values map[string]string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[id] = record{Values: maps.Clone(values), Expires: expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// DeleteExpired drops expired sessions. Expired sessions are never returned by Load, this only frees memory.
+func (s *MemoryStore) DeleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, rec := range s.sessions {
+		if now.After(rec.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// FileStore keeps one JSON file per session in a directory.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	// IDs come from cookies, never let them name arbitrary files
+	if !validID(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileStore) Load(id string) (map[string]string, time.Time, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var rec record
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("corrupt session file %s: %v", path, err)
+	}
+	if time.Now().After(rec.Expires) {
+		os.Remove(path)
+		return nil, time.Time{}, ErrNotFound
+	}
+	return rec.Values, rec.Expires, nil
+}
+
+func (s *FileStore) Save(id string, values map[string]string, expires time.Time) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record{Values: values, Expires: expires})
+	if err != nil {
+		return err
+	}
+	// write then rename so readers never see a partial file
+	tmp, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired removes the files of expired sessions.
+func (s *FileStore) DeleteExpired() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		_, _, err := s.Load(id)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// JSONFileExporter appends spans to a file as JSON lines. Field names follow OTLP/JSON, attributes are a plain object.
+type JSONFileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewJSONFileExporter(path string) (*JSONFileExporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %v", err)
+	}
+	return &JSONFileExporter{file: f}, nil
+}
+
+type jsonSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              string         `json:"kind"`
+	StartTimeUnixNano int64          `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   int64          `json:"endTimeUnixNano,string"`
+	Attributes        map[string]any `json:"attributes,omitempty"`
+	Status            jsonStatus     `json:"status"`
+}
+
+type jsonStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *JSONFileExporter) Export(span *Span) error {
+	js := jsonSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		TraceState:        span.TraceState,
+		Name:              span.Name,
+		Kind:              "SPAN_KIND_" + strings.ToUpper(string(span.Kind)),
+		StartTimeUnixNano: span.Start.UnixNano(),
+		EndTimeUnixNano:   span.End.UnixNano(),
+		Attributes:        span.Attributes,
+		Status:            jsonStatus{Code: "STATUS_CODE_UNSET"},
+	}
+	if !span.ParentSpanID.IsZero() {
+		js.ParentSpanID = span.ParentSpanID.String()
+	}
+	if span.Error != "" {
+		js.Status = jsonStatus{Code: "STATUS_CODE_ERROR", Message: span.Error}
+	}
+	data, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.file.Write(append(data, '\n'))
+	return err
+}
+
+func (e *JSONFileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
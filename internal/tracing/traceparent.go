@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var errInvalidTraceParent = errors.New("invalid traceparent")
+
+const maxTraceStateMembers = 32
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsZero() bool {
+	return id == TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsZero() bool {
+	return id == SpanID{}
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// ParseTraceParent parses a W3C traceparent header such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+	s = strings.TrimSpace(s)
+	if len(s) < 55 || !isLowerHex(s[:2]) || s[:2] == "ff" {
+		return sc, errInvalidTraceParent
+	}
+	// version 00 is exactly 55 characters, later versions may append fields after another '-'
+	if s[:2] == "00" && len(s) != 55 || len(s) > 55 && s[55] != '-' {
+		return sc, errInvalidTraceParent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, errInvalidTraceParent
+	}
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return sc, errInvalidTraceParent
+	}
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	if sc.TraceID.IsZero() || sc.SpanID.IsZero() {
+		return sc, errInvalidTraceParent
+	}
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Sampled = f[0]&1 == 1
+	return sc, nil
+}
+
+// TraceParent formats sc as a version 00 traceparent header.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ValidTraceState reports whether s is a well-formed tracestate header. Invalid ones must be dropped.
+func ValidTraceState(s string) bool {
+	members := 0
+	seen := map[string]bool{}
+	for _, member := range strings.Split(s, ",") {
+		member = strings.Trim(member, " \t")
+		if member == "" {
+			continue
+		}
+		members++
+		key, value, found := strings.Cut(member, "=")
+		if !found || !validTraceStateKey(key) || !validTraceStateValue(value) || seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return members <= maxTraceStateMembers
+}
+
+// validTraceStateKey accepts "vendor" and "tenant@system" keys.
+func validTraceStateKey(key string) bool {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		return len(key) <= 256 && key != "" && isLCAlpha(key[0]) && allKeyChars(key)
+	}
+	return tenant != "" && len(tenant) <= 241 && allKeyChars(tenant) &&
+		system != "" && len(system) <= 14 && isLCAlpha(system[0]) && allKeyChars(system)
+}
+
+func allKeyChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(isLCAlpha(c) || '0' <= c && c <= '9' || strings.IndexByte("_-*/", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func validTraceStateValue(v string) bool {
+	if v == "" || len(v) > 256 || v[len(v)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] > 0x7e || v[i] == ',' || v[i] == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLCAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
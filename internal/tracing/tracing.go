@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/lordvorath/httpfromtcp/internal/server"
+)
+
+type SpanKind string
+
+const (
+	KindServer SpanKind = "server"
+	KindClient SpanKind = "client"
+)
+
+// Exporter receives every finished, sampled span.
+type Exporter interface {
+	Export(span *Span) error
+}
+
+type Tracer struct {
+	exporter Exporter
+}
+
+type contextKey struct{}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Span is one timed operation in a trace. Its fields must not be changed after End.
+type Span struct {
+	SpanContext
+	ParentSpanID SpanID
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Error        string
+
+	mu     sync.Mutex
+	tracer *Tracer
+	ended  bool
+}
+
+// StartSpan starts a span as a child of parent, or as the root of a new sampled trace if parent is zero.
+func (t *Tracer) StartSpan(parent SpanContext, name string, kind SpanKind) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]any{},
+		tracer:     t,
+	}
+	if parent.TraceID.IsZero() {
+		rand.Read(span.TraceID[:])
+		span.Sampled = true
+	} else {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+		span.Sampled = parent.Sampled
+		span.TraceState = parent.TraceState
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+// StartChild starts a span within the same trace, e.g. for an outgoing call.
+func (s *Span) StartChild(name string, kind SpanKind) *Span {
+	return s.tracer.StartSpan(s.SpanContext, name, kind)
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = message
+}
+
+// Inject adds traceparent and tracestate headers for s to an outgoing request.
+func (s *Span) Inject(h headers.Headers) {
+	h.Set("traceparent", s.TraceParent())
+	if s.TraceState != "" {
+		h.Set("tracestate", s.TraceState)
+	}
+}
+
+// Finish records the end time and hands a sampled span to the exporter. Later calls do nothing.
+func (s *Span) Finish() error {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return nil
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if !s.Sampled || s.tracer.exporter == nil {
+		return nil
+	}
+	return s.tracer.exporter.Export(s)
+}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// SpanFromRequest returns the server span of a request passing through Middleware, or nil.
+func SpanFromRequest(req *request.Request) *Span {
+	return SpanFromContext(req.Context())
+}
+
+// Middleware continues the trace from the request's traceparent header, or starts a new one,
+// and records a server span with HTTP semantic convention attributes around the handler.
+func (t *Tracer) Middleware(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		var parent SpanContext
+		if tp, ok := req.Headers.Get("traceparent"); ok {
+			sc, err := ParseTraceParent(tp)
+			if err == nil {
+				parent = sc
+				if ts, ok := req.Headers.Get("tracestate"); ok && ValidTraceState(ts) {
+					parent.TraceState = ts
+				}
+			}
+		}
+
+		method := req.RequestLine.Method
+		span := t.StartSpan(parent, method, KindServer)
+		span.Attributes["http.request.method"] = method
+		span.Attributes["url.path"] = req.Path()
+		if query := req.RawQuery(); query != "" {
+			span.Attributes["url.query"] = query
+		}
+		span.Attributes["network.protocol.version"] = req.RequestLine.HttpVersion
+		if host, ok := req.Headers.Get("Host"); ok {
+			span.Attributes["server.address"] = host
+		}
+		if ua, ok := req.Headers.Get("User-Agent"); ok {
+			span.Attributes["user_agent.original"] = ua
+		}
+		if req.RemoteAddr != "" {
+			if ip, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+				span.Attributes["client.address"] = ip
+				if p, err := strconv.Atoi(port); err == nil {
+					span.Attributes["client.port"] = p
+				}
+			}
+		}
+
+		req = req.WithContext(ContextWithSpan(req.Context(), span))
+
+		next(w, req)
+
+		status := w.StatusCode()
+		span.SetAttribute("http.response.status_code", int(status))
+		span.SetAttribute("http.response.body.size", w.BytesWritten())
+		if status >= 500 {
+			span.SetError(strconv.Itoa(int(status)))
+		}
+		err := span.Finish()
+		if err != nil {
+			w.Logger().Warn("failed to export span", "error", err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	// Test: Valid header
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	// Test: Future versions may append fields
+	sc, err = ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled)
+
+	// Test: Invalid headers
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-600f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceParent(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestValidTraceState(t *testing.T) {
+	assert.True(t, ValidTraceState("rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"))
+	assert.True(t, ValidTraceState("tenant@vendor=x , other=y"))
+	assert.False(t, ValidTraceState("Upper=x"))
+	assert.False(t, ValidTraceState("a=1,a=2"))
+	assert.False(t, ValidTraceState("a=b=c"))
+	assert.False(t, ValidTraceState("novalue"))
+	assert.False(t, ValidTraceState(manyMembers(33)))
+	assert.True(t, ValidTraceState(manyMembers(32)))
+}
+
+func manyMembers(n int) string {
+	var members []string
+	for i := range n {
+		members = append(members, "k"+strings.Repeat("x", i)+"=v")
+	}
+	return strings.Join(members, ",")
+}
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *memoryExporter) Export(span *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := &memoryExporter{}
+	tracer := NewTracer(exp)
+
+	serve := func(reqText string, handler func(w *response.Writer, req *request.Request)) {
+		req, err := request.RequestFromReader(strings.NewReader(reqText))
+		require.NoError(t, err)
+		req.RemoteAddr = "192.0.2.1:4000"
+		var buf bytes.Buffer
+		tracer.Middleware(handler)(&response.Writer{W: &buf}, req)
+	}
+
+	// Test: Continues the incoming trace and propagates to outgoing calls
+	var outgoing headers.Headers
+	serve("GET /items?page=2 HTTP/1.1\r\nHost: example.com\r\n"+
+		"traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\ntracestate: rojo=1\r\n\r\n",
+		func(w *response.Writer, req *request.Request) {
+			span := SpanFromRequest(req)
+			child := span.StartChild("GET upstream", KindClient)
+			outgoing = headers.NewHeaders()
+			child.Inject(outgoing)
+			child.Finish()
+			w.WriteResponse(response.StatusOk, nil, []byte("hello"))
+		})
+	require.Len(t, exp.spans, 2)
+	client, srv := exp.spans[0], exp.spans[1]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", srv.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", srv.ParentSpanID.String())
+	assert.Equal(t, "rojo=1", srv.TraceState)
+	assert.Equal(t, KindServer, srv.Kind)
+	assert.Equal(t, "GET", srv.Attributes["http.request.method"])
+	assert.Equal(t, "/items", srv.Attributes["url.path"])
+	assert.Equal(t, "page=2", srv.Attributes["url.query"])
+	assert.Equal(t, "example.com", srv.Attributes["server.address"])
+	assert.Equal(t, "192.0.2.1", srv.Attributes["client.address"])
+	assert.Equal(t, 200, srv.Attributes["http.response.status_code"])
+	assert.Equal(t, int64(5), srv.Attributes["http.response.body.size"])
+	assert.Equal(t, srv.SpanID, client.ParentSpanID)
+	assert.Equal(t, client.TraceParent(), outgoing["traceparent"])
+	assert.Equal(t, "rojo=1", outgoing["tracestate"])
+
+	// Test: Invalid traceparent starts a new trace and drops tracestate
+	exp.spans = nil
+	serve("GET / HTTP/1.1\r\ntraceparent: garbage\r\ntracestate: rojo=1\r\n\r\n", func(w *response.Writer, _ *request.Request) {
+		w.WriteResponse(response.StatusInternalError, nil, nil)
+	})
+	require.Len(t, exp.spans, 1)
+	assert.True(t, exp.spans[0].ParentSpanID.IsZero())
+	assert.False(t, exp.spans[0].TraceID.IsZero())
+	assert.Empty(t, exp.spans[0].TraceState)
+	assert.Equal(t, "500", exp.spans[0].Error)
+
+	// Test: Unsampled parents are not exported
+	exp.spans = nil
+	serve("GET / HTTP/1.1\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00\r\n\r\n", func(w *response.Writer, _ *request.Request) {
+		w.WriteResponse(response.StatusOk, nil, nil)
+	})
+	assert.Empty(t, exp.spans)
+}
+
+func TestJSONFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exp, err := NewJSONFileExporter(path)
+	require.NoError(t, err)
+	tracer := NewTracer(exp)
+
+	root := tracer.StartSpan(SpanContext{}, "GET", KindServer)
+	root.SetAttribute("http.request.method", "GET")
+	child := root.StartChild("query", KindClient)
+	child.SetError("timeout")
+	require.NoError(t, child.Finish())
+	require.NoError(t, root.Finish())
+	require.NoError(t, exp.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		lines = append(lines, m)
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "SPAN_KIND_CLIENT", lines[0]["kind"])
+	assert.Equal(t, root.SpanID.String(), lines[0]["parentSpanId"])
+	assert.Equal(t, map[string]any{"code": "STATUS_CODE_ERROR", "message": "timeout"}, lines[0]["status"])
+	assert.Equal(t, root.TraceID.String(), lines[1]["traceId"])
+	assert.NotContains(t, lines[1], "parentSpanId")
+	assert.Equal(t, map[string]any{"http.request.method": "GET"}, lines[1]["attributes"])
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+type Dialer struct {
+	Subprotocols      []string
+	EnableCompression bool
+	HandshakeTimeout  time.Duration
+}
+
+func Dial(addr, target string) (*Conn, error) {
+	d := &Dialer{}
+	return d.Dial(addr, target)
+}
+
+// Dial opens a TCP connection to addr and performs the client side of the opening handshake for target.
+func (d *Dialer) Dial(addr, target string) (*Conn, error) {
+	netConn, err := net.DialTimeout("tcp", addr, d.HandshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %v", addr, err)
+	}
+	c, err := d.Handshake(netConn, addr, target)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Handshake performs the client side of the opening handshake over an existing connection.
+func (d *Dialer) Handshake(netConn net.Conn, host, target string) (*Conn, error) {
+	if d.HandshakeTimeout > 0 {
+		netConn.SetDeadline(time.Now().Add(d.HandshakeTimeout))
+		defer netConn.SetDeadline(time.Time{})
+	}
+
+	rawKey := make([]byte, 16)
+	_, err := rand.Read(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	key := base64.StdEncoding.EncodeToString(rawKey)
+
+	var sb strings.Builder
+	sb.WriteString("GET " + target + " HTTP/1.1\r\n")
+	sb.WriteString("Host: " + host + "\r\n")
+	sb.WriteString("Upgrade: websocket\r\n")
+	sb.WriteString("Connection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Key: " + key + "\r\n")
+	sb.WriteString("Sec-WebSocket-Version: 13\r\n")
+	if len(d.Subprotocols) > 0 {
+		sb.WriteString("Sec-WebSocket-Protocol: " + strings.Join(d.Subprotocols, ", ") + "\r\n")
+	}
+	if d.EnableCompression {
+		sb.WriteString("Sec-WebSocket-Extensions: " + extensionName + "; client_no_context_takeover\r\n")
+	}
+	sb.WriteString("\r\n")
+
+	_, err = netConn.Write([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(netConn)
+	statusLine, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handshake response: %v", err)
+	}
+	statusLine = strings.TrimRight(statusLine, "\r\n")
+	if !strings.HasPrefix(statusLine, "HTTP/1.1 101") {
+		return nil, fmt.Errorf("unexpected handshake response: %s", statusLine)
+	}
+
+	h := headers.NewHeaders()
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read handshake headers: %v", err)
+		}
+		_, done, err := h.Parse([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	if !headerHasToken(h, "Upgrade", "websocket") || !headerHasToken(h, "Connection", "upgrade") {
+		return nil, fmt.Errorf("handshake response is missing upgrade headers")
+	}
+	if accept, _ := h.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+		return nil, fmt.Errorf("invalid Sec-WebSocket-Accept: %q", accept)
+	}
+
+	c := newConn(netConn, br, false)
+	c.Subprotocol, _ = h.Get("Sec-WebSocket-Protocol")
+
+	if exts, ok := h.Get("Sec-WebSocket-Extensions"); ok {
+		for _, ext := range parseExtensions(exts) {
+			if ext.name != extensionName || !d.EnableCompression {
+				return nil, fmt.Errorf("server accepted unrequested extension: %s", ext.name)
+			}
+			c.compression = true
+			_, noTakeover := ext.params["server_no_context_takeover"]
+			c.readTakeover = !noTakeover
+		}
+	}
+
+	return c, nil
+}
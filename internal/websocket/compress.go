@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+)
+
+// permessage-deflate (RFC 7692). Outgoing messages are always compressed without context takeover,
+// incoming messages are decompressed with the peer's sliding window carried across messages unless
+// the peer agreed not to use it.
+
+const (
+	extensionName           = "permessage-deflate"
+	defaultCompressionLevel = flate.DefaultCompression
+	maxWindowSize           = 1 << 15
+)
+
+var (
+	deflateTail      = []byte{0x00, 0x00, 0xff, 0xff}
+	deflateFinal     = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+	errMessageTooBig = errors.New("message too big")
+)
+
+func (c *Conn) SetCompressionLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level: %d", level)
+	}
+	c.compressionLevel = level
+	return nil
+}
+
+func compressPayload(p []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %v", err)
+	}
+	_, err = fw.Write(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress message: %v", err)
+	}
+	err = fw.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress message: %v", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+func (c *Conn) decompress(p []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateFinal))
+
+	var fr io.ReadCloser
+	if c.readTakeover {
+		fr = flate.NewReaderDict(src, c.readHistory)
+	} else {
+		fr = flate.NewReader(src)
+	}
+	defer fr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(fr, c.ReadLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > c.ReadLimit {
+		return nil, errMessageTooBig
+	}
+
+	if c.readTakeover {
+		c.readHistory = append(c.readHistory, out...)
+		if len(c.readHistory) > maxWindowSize {
+			c.readHistory = c.readHistory[len(c.readHistory)-maxWindowSize:]
+		}
+	}
+	return out, nil
+}
+
+type extension struct {
+	name   string
+	params map[string]string
+}
+
+// parseExtensions parses a Sec-WebSocket-Extensions value such as
+// "permessage-deflate; client_max_window_bits, x-foo".
+func parseExtensions(value string) []extension {
+	var exts []extension
+	for _, item := range headers.SplitList(value) {
+		name, params, err := headers.ParseParams(item)
+		if err != nil || name == "" {
+			continue
+		}
+		exts = append(exts, extension{
+			name:   strings.ToLower(name),
+			params: params,
+		})
+	}
+	return exts
+}
+
+// negotiateDeflate picks the first permessage-deflate offer we can honour and returns the response value.
+// The server never uses context takeover, so server_no_context_takeover is always part of the answer.
+func negotiateDeflate(offers []extension) (resp string, clientTakeover bool, ok bool) {
+	for _, ext := range offers {
+		if ext.name != extensionName {
+			continue
+		}
+		supported := true
+		for k, v := range ext.params {
+			switch k {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				if v != "15" {
+					supported = false
+				}
+			default:
+				supported = false
+			}
+		}
+		if !supported {
+			continue
+		}
+
+		resp = extensionName + "; server_no_context_takeover"
+		_, noClientTakeover := ext.params["client_no_context_takeover"]
+		if noClientTakeover {
+			resp += "; client_no_context_takeover"
+		}
+		return resp, !noClientTakeover, true
+	}
+	return "", false, false
+}
@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/lordvorath/httpfromtcp/internal/headers"
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type Upgrader struct {
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// EnableCompression allows permessage-deflate when the client offers it.
+	EnableCompression bool
+	// CheckOrigin rejects the handshake with 403 when it returns false. All origins are accepted when nil.
+	CheckOrigin func(req *request.Request) bool
+}
+
+// Upgrade validates the opening handshake, answers it with 101 Switching Protocols and takes over the connection.
+// On failure an error response has already been written to w.
+func (u *Upgrader) Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	if req.RequestLine.Method != "GET" {
+		return nil, handshakeError(w, response.StatusMethodNotAllowed, "websocket handshake requires GET")
+	}
+	if !headerHasToken(req.Headers, "Connection", "upgrade") {
+		return nil, handshakeError(w, response.StatusBadRequest, "missing 'Connection: upgrade' header")
+	}
+	if !headerHasToken(req.Headers, "Upgrade", "websocket") {
+		return nil, handshakeError(w, response.StatusBadRequest, "missing 'Upgrade: websocket' header")
+	}
+	if version, _ := req.Headers.Get("Sec-WebSocket-Version"); version != "13" {
+		h := response.GetDefaultHeaders(0)
+		h.Set("Sec-WebSocket-Version", "13")
+		w.WriteResponse(response.StatusUpgradeRequired, h, []byte("unsupported websocket version\n"))
+		return nil, fmt.Errorf("unsupported websocket version: %q", version)
+	}
+
+	key, _ := req.Headers.Get("Sec-WebSocket-Key")
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, response.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	if u.CheckOrigin != nil && !u.CheckOrigin(req) {
+		return nil, handshakeError(w, response.StatusForbidden, "origin not allowed")
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", acceptKey(key))
+
+	subprotocol := u.selectSubprotocol(req)
+	if subprotocol != "" {
+		h.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+
+	compression := false
+	readTakeover := false
+	if u.EnableCompression {
+		offers, _ := req.Headers.Get("Sec-WebSocket-Extensions")
+		resp, clientTakeover, ok := negotiateDeflate(parseExtensions(offers))
+		if ok {
+			h.Set("Sec-WebSocket-Extensions", resp)
+			compression = true
+			readTakeover = clientTakeover
+		}
+	}
+
+	err = w.WriteStatusLine(response.StatusSwitchingProtocols)
+	if err != nil {
+		return nil, err
+	}
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+
+	netConn, buffered, err := w.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %v", err)
+	}
+
+	br := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), netConn))
+	c := newConn(netConn, br, true)
+	c.Subprotocol = subprotocol
+	c.compression = compression
+	c.readTakeover = readTakeover
+	return c, nil
+}
+
+func (u *Upgrader) selectSubprotocol(req *request.Request) string {
+	offered, ok := req.Headers.Get("Sec-WebSocket-Protocol")
+	if !ok {
+		return ""
+	}
+	for _, p := range strings.Split(offered, ",") {
+		p = strings.TrimSpace(p)
+		if slices.Contains(u.Subprotocols, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(h headers.Headers, key, token string) bool {
+	val, ok := h.Get(key)
+	if !ok {
+		return false
+	}
+	for _, t := range strings.Split(val, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func handshakeError(w *response.Writer, code response.StatusCode, message string) error {
+	w.WriteResponse(code, nil, []byte(message+"\n"))
+	return fmt.Errorf("websocket handshake failed: %s", message)
+}
@@ -0,0 +1,478 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+	CloseMessage  MessageType = 8
+	PingMessage   MessageType = 9
+	PongMessage   MessageType = 10
+)
+
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	defaultReadLimit  = 16 << 20
+	closeTimeout      = 5 * time.Second
+)
+
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+var ErrCloseSent = errors.New("websocket: close frame already sent")
+
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	// ReadLimit caps the size of a single (reassembled, decompressed) message.
+	ReadLimit int64
+	// FragmentSize splits outgoing data messages into frames of at most this many bytes when > 0.
+	FragmentSize int
+
+	// PongHandler, if set, is called with the payload of every pong received.
+	PongHandler func(data []byte)
+
+	Subprotocol string
+
+	compression      bool
+	compressionLevel int
+	readTakeover     bool
+	readHistory      []byte
+
+	writeMu       sync.Mutex
+	closeSent     bool
+	closeReceived bool
+}
+
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:             conn,
+		br:               br,
+		isServer:         isServer,
+		ReadLimit:        defaultReadLimit,
+		compressionLevel: defaultCompressionLevel,
+	}
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage returns the next complete data message, reassembling fragments and answering pings on the way.
+// A close frame from the peer is answered and reported as a *CloseError.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var msgType MessageType
+	var compressed bool
+	var payload []byte
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case opPing:
+			err := c.WriteControl(PongMessage, f.payload)
+			if err != nil && !errors.Is(err, ErrCloseSent) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.PongHandler != nil {
+				c.PongHandler(f.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(f.payload)
+		case opContinuation:
+			if msgType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation frame without a message in progress")
+			}
+		case opText, opBinary:
+			if msgType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new data frame while a fragmented message is in progress")
+			}
+			msgType = MessageType(f.opcode)
+			compressed = f.rsv1
+		}
+
+		if int64(len(payload))+int64(len(f.payload)) > c.ReadLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, "message exceeds read limit")
+		}
+		payload = append(payload, f.payload...)
+
+		if f.fin {
+			break
+		}
+	}
+
+	if compressed {
+		var err error
+		payload, err = c.decompress(payload)
+		if err != nil {
+			if errors.Is(err, errMessageTooBig) {
+				return 0, nil, c.fail(CloseMessageTooBig, "message exceeds read limit")
+			}
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("invalid compressed payload: %v", err))
+		}
+	}
+
+	if msgType == TextMessage && !utf8.Valid(payload) {
+		return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+	}
+
+	return msgType, payload, nil
+}
+
+func (c *Conn) readFrame() (*frame, error) {
+	var head [2]byte
+	_, err := io.ReadFull(c.br, head[:])
+	if err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		fin:    head[0]&finBit != 0,
+		rsv1:   head[0]&rsv1Bit != 0,
+		opcode: int(head[0] & 0x0f),
+	}
+	masked := head[1]&maskBit != 0
+	length := uint64(head[1] & 0x7f)
+
+	if head[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+
+	isControl := f.opcode >= opClose
+	switch f.opcode {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+	}
+
+	if f.rsv1 && (!c.compression || isControl || f.opcode == opContinuation) {
+		return nil, c.fail(CloseProtocolError, "unexpected RSV1 bit")
+	}
+	if isControl && !f.fin {
+		return nil, c.fail(CloseProtocolError, "fragmented control frame")
+	}
+	if masked != c.isServer {
+		if c.isServer {
+			return nil, c.fail(CloseProtocolError, "client frame is not masked")
+		}
+		return nil, c.fail(CloseProtocolError, "server frame is masked")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		if err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		if err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if isControl && length > maxControlPayload {
+		return nil, c.fail(CloseProtocolError, "control frame payload too long")
+	}
+	if length > uint64(c.ReadLimit) {
+		return nil, c.fail(CloseMessageTooBig, "frame exceeds read limit")
+	}
+
+	var maskKey [4]byte
+	if masked {
+		_, err = io.ReadFull(c.br, maskKey[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, f.payload)
+	if err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(maskKey, f.payload)
+	}
+
+	return f, nil
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	c.closeReceived = true
+	code := CloseNoStatusReceived
+	text := ""
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, fmt.Sprintf("invalid close code %d", code))
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason")
+		}
+		text = string(payload[2:])
+	}
+
+	var reply []byte
+	if code != CloseNoStatusReceived {
+		reply = closePayload(code, "")
+	}
+	err := c.writeFrame(opClose, true, false, reply)
+	if err != nil && !errors.Is(err, ErrCloseSent) {
+		c.conn.Close()
+		return err
+	}
+	c.conn.Close()
+
+	return &CloseError{Code: code, Text: text}
+}
+
+// fail sends a close frame with the given code, tears down the connection and returns the matching error.
+func (c *Conn) fail(code int, reason string) error {
+	c.writeFrame(opClose, true, false, closePayload(code, reason))
+	c.conn.Close()
+	return &CloseError{Code: code, Text: reason}
+}
+
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return c.WriteControl(messageType, data)
+	}
+
+	compressed := false
+	if c.compression {
+		var err error
+		data, err = compressPayload(data, c.compressionLevel)
+		if err != nil {
+			return err
+		}
+		compressed = true
+	}
+
+	opcode := int(messageType)
+	if c.FragmentSize <= 0 || len(data) <= c.FragmentSize {
+		return c.writeFrame(opcode, true, compressed, data)
+	}
+
+	for len(data) > 0 {
+		n := min(c.FragmentSize, len(data))
+		err := c.writeFrame(opcode, n == len(data), compressed, data[:n])
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		opcode = opContinuation
+		compressed = false
+	}
+	return nil
+}
+
+func (c *Conn) WriteControl(messageType MessageType, data []byte) error {
+	switch messageType {
+	case CloseMessage, PingMessage, PongMessage:
+	default:
+		return fmt.Errorf("websocket: %d is not a control message type", messageType)
+	}
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("websocket: control frame payload too long: %d", len(data))
+	}
+	return c.writeFrame(int(messageType), true, false, data)
+}
+
+func (c *Conn) writeFrame(opcode int, fin bool, rsv1 bool, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= finBit
+	}
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	buf = append(buf, b0)
+
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch {
+	case len(payload) <= 125:
+		buf = append(buf, b1|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var maskKey [4]byte
+		_, err := rand.Read(maskKey[:])
+		if err != nil {
+			return fmt.Errorf("failed to generate mask key: %v", err)
+		}
+		buf = append(buf, maskKey[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(maskKey, buf[start:])
+	}
+
+	_, err := c.conn.Write(buf)
+	if err != nil {
+		return fmt.Errorf("failed to write frame: %v", err)
+	}
+	return nil
+}
+
+// CloseWithCode performs the closing handshake: it sends a close frame and waits briefly for the peer's reply.
+// It must not be called concurrently with ReadMessage.
+func (c *Conn) CloseWithCode(code int, reason string) error {
+	err := c.writeFrame(opClose, true, false, closePayload(code, reason))
+	if err != nil && !errors.Is(err, ErrCloseSent) {
+		c.conn.Close()
+		return err
+	}
+
+	if !c.closeReceived {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		for {
+			f, err := c.readFrame()
+			if err != nil || f.opcode == opClose {
+				break
+			}
+		}
+	}
+	return c.conn.Close()
+}
+
+// Close closes the underlying connection without a closing handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func closePayload(code int, reason string) []byte {
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	p := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return append(p, reason...)
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
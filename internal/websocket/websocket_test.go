@@ -0,0 +1,277 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/lordvorath/httpfromtcp/internal/request"
+	"github.com/lordvorath/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer upgrades every connection and echoes data messages back until the connection ends.
+// The error that ended each connection is sent on the returned channel.
+func echoServer(t *testing.T, u *Upgrader) (string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				req, err := request.RequestFromReader(conn)
+				if err != nil {
+					conn.Close()
+					done <- err
+					return
+				}
+				w := response.NewWriter(conn)
+				w.SetBuffered(req.Buffered())
+				ws, err := u.Upgrade(w, req)
+				if err != nil {
+					conn.Close()
+					done <- err
+					return
+				}
+				for {
+					mt, msg, err := ws.ReadMessage()
+					if err != nil {
+						done <- err
+						return
+					}
+					err = ws.WriteMessage(mt, msg)
+					if err != nil {
+						done <- err
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), done
+}
+
+func TestEcho(t *testing.T) {
+	addr, done := echoServer(t, &Upgrader{})
+
+	// Test: text and binary messages are echoed
+	c, err := Dial(addr, "/ws")
+	require.NoError(t, err)
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("hello")))
+	mt, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, mt)
+	assert.Equal(t, "hello", string(msg))
+
+	big := bytes.Repeat([]byte{0xde, 0xad}, 70000)
+	require.NoError(t, c.WriteMessage(BinaryMessage, big))
+	mt, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, BinaryMessage, mt)
+	assert.Equal(t, big, msg)
+
+	// Test: fragmented message is reassembled
+	c.FragmentSize = 3
+	require.NoError(t, c.WriteMessage(TextMessage, []byte("fragmented message")))
+	mt, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, mt)
+	assert.Equal(t, "fragmented message", string(msg))
+	c.FragmentSize = 0
+
+	// Test: ping between fragments is answered with a pong
+	pong := make(chan []byte, 1)
+	c.PongHandler = func(data []byte) { pong <- data }
+	require.NoError(t, c.writeFrame(opText, false, false, []byte("frag")))
+	require.NoError(t, c.WriteControl(PingMessage, []byte("are you there")))
+	require.NoError(t, c.writeFrame(opContinuation, true, false, []byte("ment")))
+	_, msg, err = c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "fragment", string(msg))
+	assert.Equal(t, "are you there", string(<-pong))
+
+	// Test: closing handshake
+	require.NoError(t, c.CloseWithCode(CloseNormalClosure, "bye"))
+	var ce *CloseError
+	require.ErrorAs(t, <-done, &ce)
+	assert.Equal(t, CloseNormalClosure, ce.Code)
+	assert.Equal(t, "bye", ce.Text)
+}
+
+func TestProtocolErrors(t *testing.T) {
+	addr, done := echoServer(t, &Upgrader{})
+
+	// Test: invalid UTF-8 in a text message
+	c, err := Dial(addr, "/")
+	require.NoError(t, err)
+	require.NoError(t, c.WriteMessage(TextMessage, []byte{0xce, 0xba, 0xe1, 0xbd}))
+	_, _, err = c.ReadMessage()
+	var ce *CloseError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, CloseInvalidFramePayloadData, ce.Code)
+	<-done
+
+	// Test: reserved bits set
+	c, err = Dial(addr, "/")
+	require.NoError(t, err)
+	c.writeMu.Lock()
+	_, err = c.conn.Write([]byte{finBit | rsv2Bit | opText, maskBit, 0, 0, 0, 0})
+	c.writeMu.Unlock()
+	require.NoError(t, err)
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, CloseProtocolError, ce.Code)
+	<-done
+
+	// Test: unmasked client frame
+	c, err = Dial(addr, "/")
+	require.NoError(t, err)
+	_, err = c.conn.Write([]byte{finBit | opText, 2, 'h', 'i'})
+	require.NoError(t, err)
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, CloseProtocolError, ce.Code)
+	<-done
+
+	// Test: control frame longer than 125 bytes
+	c, err = Dial(addr, "/")
+	require.NoError(t, err)
+	require.NoError(t, c.writeFrame(opPing, true, false, bytes.Repeat([]byte("a"), 126)))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, CloseProtocolError, ce.Code)
+	<-done
+
+	// Test: continuation without a message in progress
+	c, err = Dial(addr, "/")
+	require.NoError(t, err)
+	require.NoError(t, c.writeFrame(opContinuation, true, false, []byte("x")))
+	_, _, err = c.ReadMessage()
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, CloseProtocolError, ce.Code)
+	<-done
+
+	// Test: invalid close code
+	c, err = Dial(addr, "/")
+	require.NoError(t, err)
+	require.NoError(t, c.writeFrame(opClose, true, false, binary.BigEndian.AppendUint16(nil, 1005)))
+	_, _, err = c.ReadMessage()
+	require.Error(t, err)
+	require.ErrorAs(t, <-done, &ce)
+	assert.Equal(t, CloseProtocolError, ce.Code)
+}
+
+func TestCompression(t *testing.T) {
+	addr, done := echoServer(t, &Upgrader{EnableCompression: true})
+
+	// Test: compressed messages round trip
+	d := &Dialer{EnableCompression: true}
+	c, err := d.Dial(addr, "/")
+	require.NoError(t, err)
+	require.True(t, c.compression)
+
+	text := strings.Repeat("compress me please ", 1000)
+	for range 3 {
+		require.NoError(t, c.WriteMessage(TextMessage, []byte(text)))
+		mt, msg, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, TextMessage, mt)
+		assert.Equal(t, text, string(msg))
+	}
+	require.NoError(t, c.CloseWithCode(CloseNormalClosure, ""))
+	<-done
+
+	// Test: client using context takeover across messages
+	netConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = netConn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(netConn)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+	}
+	c = newConn(netConn, br, false)
+	c.compression = true
+
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	require.NoError(t, err)
+	for _, m := range []string{"the quick brown fox", "the quick brown fox jumps"} {
+		buf.Reset()
+		fw.Write([]byte(m))
+		fw.Flush()
+		require.NoError(t, c.writeFrame(opText, true, true, bytes.TrimSuffix(buf.Bytes(), deflateTail)))
+		_, msg, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, m, string(msg))
+	}
+	require.NoError(t, c.CloseWithCode(CloseNormalClosure, ""))
+	<-done
+}
+
+func TestHandshake(t *testing.T) {
+	addr, done := echoServer(t, &Upgrader{Subprotocols: []string{"chat"}})
+
+	// Test: subprotocol selection
+	d := &Dialer{Subprotocols: []string{"superchat", "chat"}}
+	c, err := d.Dial(addr, "/")
+	require.NoError(t, err)
+	assert.Equal(t, "chat", c.Subprotocol)
+	require.NoError(t, c.CloseWithCode(CloseNormalClosure, ""))
+	<-done
+
+	// Test: Sec-WebSocket-Accept from RFC 6455
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+
+	// Test: unsupported version
+	netConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = netConn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 8\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := io.ReadAll(netConn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(resp), "HTTP/1.1 426 Upgrade Required\r\n"))
+	assert.Contains(t, string(resp), "sec-websocket-version: 13\r\n")
+	require.Error(t, <-done)
+
+	// Test: frame sent in the same packet as the handshake is not lost
+	netConn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	frame := []byte{finBit | opText, maskBit | 2, 0, 0, 0, 0, 'h', 'i'}
+	_, err = netConn.Write(append([]byte("GET / HTTP/1.1\r\nHost: x\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"), frame...))
+	require.NoError(t, err)
+	br := bufio.NewReader(netConn)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+	}
+	c = newConn(netConn, br, false)
+	_, msg, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(msg))
+	require.NoError(t, c.CloseWithCode(CloseNormalClosure, ""))
+	<-done
+}